@@ -0,0 +1,85 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 09:52:17
+  @desc: 布隆过滤器,用于防止缓存穿透
+
+**/
+
+package bloom
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var (
+	// InvalidParamsErr 预期元素数量或者误判率不合法
+	InvalidParamsErr = errors.New("bloom: expected items must be positive and false positive rate must be in (0, 1)")
+	// TooLargeErr 过滤器超过了Redis位图的最大长度(2^32位)
+	TooLargeErr = errors.New("bloom: filter exceeds the maximum redis bitmap size")
+)
+
+// Redis位图的最大位数
+const maxRedisBits = 1 << 32
+
+// Filter 布隆过滤器
+// MightContain 返回false表示元素一定不存在,返回true表示元素可能存在(存在一定的误判率)
+// 实现了 caches.KeyFilter,可以直接用于 caches.Aside 拦截一定不存在的Key
+type Filter interface {
+	// Add 添加一个或多个元素
+	Add(ctx context.Context, items ...string) error
+	// MightContain 判断元素是否可能存在
+	MightContain(ctx context.Context, item string) (bool, error)
+}
+
+// Estimate 根据预期元素数量n以及误判率p计算位数m以及哈希函数个数k
+// m = -n*ln(p)/(ln2)^2, k = m/n*ln2
+func Estimate(n uint64, p float64) (m uint64, k uint64) {
+	m = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k = uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return m, k
+}
+
+// 校验参数并计算过滤器的大小
+func estimate(n uint64, p float64) (uint64, uint64, error) {
+	if n == 0 || p <= 0 || p >= 1 {
+		return 0, 0, InvalidParamsErr
+	}
+	m, k := Estimate(n, p)
+	return m, k, nil
+}
+
+// 元素在过滤器中对应的k个位置
+// 基于FNV-128a的两个64位哈希值进行双重哈希: h1 + i*h2
+func locations(item string, m, k uint64) []uint64 {
+	hash := fnv.New128a()
+	_, _ = hash.Write([]byte(item))
+	sum := hash.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[i+8])
+	}
+	// FNV对相近的输入区分度不足,再经过一次混淆
+	h1, h2 = mix(h1), mix(h2)
+	offsets := make([]uint64, k)
+	for i := uint64(0); i < k; i++ {
+		offsets[i] = (h1 + i*h2) % m
+	}
+	return offsets
+}
+
+// MurmurHash3的64位混淆函数
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
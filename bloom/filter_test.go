@@ -0,0 +1,91 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 15:30:46
+  @desc: 布隆过滤器单元测试
+
+**/
+
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+// 测试根据预期元素数量以及误判率计算过滤器大小
+func TestEstimate(t *testing.T) {
+	is := assert.New(t)
+	m, k := Estimate(1000, 0.01)
+	is.Equal(uint64(9586), m)
+	is.Equal(uint64(7), k)
+	m, k = Estimate(1_000_000, 0.001)
+	is.Equal(uint64(14377588), m)
+	is.Equal(uint64(10), k)
+
+	_, err := NewLocalFilter(0, 0.01)
+	is.ErrorIs(err, InvalidParamsErr)
+	_, err = NewLocalFilter(100, 1)
+	is.ErrorIs(err, InvalidParamsErr)
+	_, err = NewRedisFilter(redisfake.New(t), "bloom:huge", 1<<32, 0.01)
+	is.ErrorIs(err, TooLargeErr)
+}
+
+// 对每个实现运行测试: 已添加的元素一定存在,误判率接近预期
+func TestFilter(t *testing.T) {
+	local, err := NewLocalFilter(1000, 0.01)
+	assert.NoError(t, err)
+	remote, err := NewRedisFilter(redisfake.New(t), "bloom:users", 1000, 0.01)
+	assert.NoError(t, err)
+	for name, filter := range map[string]Filter{"Local": local, "Redis": remote} {
+		filter := filter
+		t.Run(name, func(t *testing.T) {
+			is := assert.New(t)
+			ctx := context.Background()
+			items := make([]string, 1000)
+			for i := range items {
+				items[i] = fmt.Sprintf("user:%d", i)
+			}
+			is.NoError(filter.Add(ctx, items[:500]...))
+			for _, item := range items[500:] {
+				is.NoError(filter.Add(ctx, item))
+			}
+			for _, item := range items {
+				ok, err := filter.MightContain(ctx, item)
+				is.NoError(err)
+				is.True(ok, item)
+			}
+			falsePositives := 0
+			for i := 0; i < 2000; i++ {
+				ok, err := filter.MightContain(ctx, fmt.Sprintf("absent:%d", i))
+				is.NoError(err)
+				if ok {
+					falsePositives++
+				}
+			}
+			is.Less(falsePositives, 60)
+		})
+	}
+}
+
+// 测试清空过滤器,以及本地与Redis过滤器的位置计算一致
+func TestFilter_Reset(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	local, _ := NewLocalFilter(100, 0.01)
+	remote, _ := NewRedisFilter(redisfake.New(t), "bloom:reset", 100, 0.01)
+	is.Equal(fmt.Sprint(local.Size()), fmt.Sprint(remote.Size()))
+
+	is.NoError(local.Add(ctx, "order:1"))
+	is.NoError(remote.Add(ctx, "order:1"))
+	local.Reset()
+	is.NoError(remote.Reset(ctx))
+	ok, _ := local.MightContain(ctx, "order:1")
+	is.False(ok)
+	ok, err := remote.MightContain(ctx, "order:1")
+	is.NoError(err)
+	is.False(ok)
+}
@@ -0,0 +1,69 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 10:35:40
+  @desc: 进程内的布隆过滤器
+
+**/
+
+package bloom
+
+import (
+	"context"
+	"sync"
+)
+
+// LocalFilter 进程内的布隆过滤器,哈希方式与 RedisFilter 一致
+type LocalFilter struct {
+	mu sync.RWMutex
+	// 位图
+	bits []uint64
+	// 位数
+	m uint64
+	// 哈希函数个数
+	k uint64
+}
+
+// NewLocalFilter 根据预期元素数量以及误判率创建一个进程内的布隆过滤器
+func NewLocalFilter(expectedItems uint64, falsePositiveRate float64) (*LocalFilter, error) {
+	m, k, err := estimate(expectedItems, falsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}, nil
+}
+
+// Add 添加一个或多个元素
+func (filter *LocalFilter) Add(_ context.Context, items ...string) error {
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	for _, item := range items {
+		for _, offset := range locations(item, filter.m, filter.k) {
+			filter.bits[offset/64] |= 1 << (offset % 64)
+		}
+	}
+	return nil
+}
+
+// MightContain 判断元素是否可能存在
+func (filter *LocalFilter) MightContain(_ context.Context, item string) (bool, error) {
+	filter.mu.RLock()
+	defer filter.mu.RUnlock()
+	for _, offset := range locations(item, filter.m, filter.k) {
+		if filter.bits[offset/64]&(1<<(offset%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Reset 清空过滤器
+func (filter *LocalFilter) Reset() {
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	clear(filter.bits)
+}
+
+// Size 返回位数以及哈希函数个数
+func (filter *LocalFilter) Size() (bits uint64, hashes uint64) {
+	return filter.m, filter.k
+}
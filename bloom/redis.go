@@ -0,0 +1,104 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 11:12:03
+  @desc: 基于Redis位图的布隆过滤器
+
+**/
+
+package bloom
+
+import (
+	"context"
+	"github.com/zlx2019/sugar/caches"
+)
+
+// AddScript 将所有元素对应的位设置为1
+// KEYS[1]: 位图
+// ARGV: 所有元素对应的位置
+const AddScript = `
+	for i = 1, #ARGV do
+		redis.call('SETBIT', KEYS[1], ARGV[i], 1)
+	end
+	return 1
+`
+
+// ContainsScript 判断所有位置是否都为1,遇到为0的位置立即返回0
+// KEYS[1]: 位图
+// ARGV: 元素对应的位置
+const ContainsScript = `
+	for i = 1, #ARGV do
+		if redis.call('GETBIT', KEYS[1], ARGV[i]) == 0 then
+			return 0
+		end
+	end
+	return 1
+`
+
+// 布隆过滤器脚本,通过EVALSHA调用
+var (
+	addScript      = caches.NewScript("sugar_bloom_add", AddScript)
+	containsScript = caches.NewScript("sugar_bloom_contains", ContainsScript)
+)
+
+// RedisFilter 基于Redis位图的布隆过滤器,多个实例共享同一个过滤器
+type RedisFilter struct {
+	// Redis客户端
+	template caches.RedisTemplate
+	// 位图的Key
+	key string
+	// 位数
+	m uint64
+	// 哈希函数个数
+	k uint64
+}
+
+// NewRedisFilter 根据预期元素数量以及误判率创建一个Redis布隆过滤器
+// 相同key的过滤器必须使用相同的参数创建,否则位置计算不一致
+func NewRedisFilter(template caches.RedisTemplate, key string, expectedItems uint64, falsePositiveRate float64) (*RedisFilter, error) {
+	m, k, err := estimate(expectedItems, falsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+	if m > maxRedisBits {
+		return nil, TooLargeErr
+	}
+	return &RedisFilter{template: template, key: key, m: m, k: k}, nil
+}
+
+// 元素对应的位置,作为脚本参数
+func (filter *RedisFilter) args(items ...string) []any {
+	args := make([]any, 0, uint64(len(items))*filter.k)
+	for _, item := range items {
+		for _, offset := range locations(item, filter.m, filter.k) {
+			args = append(args, offset)
+		}
+	}
+	return args
+}
+
+// Add 添加一个或多个元素,所有位通过一个Lua脚本设置
+func (filter *RedisFilter) Add(ctx context.Context, items ...string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return filter.template.EvalScript(ctx, addScript, []string{filter.key}, filter.args(items...)...).Err()
+}
+
+// MightContain 判断元素是否可能存在
+func (filter *RedisFilter) MightContain(ctx context.Context, item string) (bool, error) {
+	n, err := filter.template.EvalScript(ctx, containsScript, []string{filter.key}, filter.args(item)...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Reset 清空过滤器
+func (filter *RedisFilter) Reset(ctx context.Context) error {
+	return filter.template.WithContext(ctx).Del(filter.key)
+}
+
+// Size 返回位数以及哈希函数个数
+func (filter *RedisFilter) Size() (bits uint64, hashes uint64) {
+	return filter.m, filter.k
+}
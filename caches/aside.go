@@ -0,0 +1,125 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 14:08:25
+  @desc: 旁路缓存加载
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// NotFoundErr 数据源中不存在该数据,LoadFunc 在数据不存在时应当返回该错误
+var NotFoundErr = errors.New("not found")
+
+// LoadFunc 缓存未命中时从数据源加载数据
+type LoadFunc func(ctx context.Context, key string) (any, error)
+
+// KeyFilter Key过滤器,通常为布隆过滤器,用于拦截一定不存在的Key
+type KeyFilter interface {
+	// MightContain 返回false表示Key一定不存在
+	MightContain(ctx context.Context, key string) (bool, error)
+}
+
+// AsideOption 旁路缓存选项
+type AsideOption func(aside *Aside)
+
+// WithLoadExpire 设置加载后写入缓存的有效期,默认为10分钟,不大于0时永不过期
+func WithLoadExpire(expire time.Duration) AsideOption {
+	return func(aside *Aside) {
+		aside.expire = expire
+	}
+}
+
+// WithNegativeTTL 开启负缓存: 加载函数返回 NotFoundErr 时写入墓碑,有效期为ttl
+// 墓碑有效期内读取该Key直接得到 Reply.Absent(),不再访问数据源;ttl不大于0时不写入墓碑
+// 数据被创建后应当删除该Key或者直接覆盖,否则要等到墓碑过期后才能读取到
+func WithNegativeTTL(ttl time.Duration) AsideOption {
+	return func(aside *Aside) {
+		aside.negativeTTL = ttl
+	}
+}
+
+// WithKeyFilter 设置Key过滤器,过滤器判断Key一定不存在时直接返回 NotFoundErr,不再访问数据源
+// 过滤器出错时忽略过滤器,继续加载
+func WithKeyFilter(filter KeyFilter) AsideOption {
+	return func(aside *Aside) {
+		aside.filter = filter
+	}
+}
+
+// Aside 旁路缓存: 先读缓存,未命中时从数据源加载并写入缓存
+type Aside struct {
+	// 缓存模板
+	template CacheTemplate
+	// 写入缓存的有效期
+	expire time.Duration
+	// 墓碑的有效期
+	negativeTTL time.Duration
+	// Key过滤器
+	filter KeyFilter
+}
+
+// NewAside 基于一个缓存模板创建旁路缓存
+func NewAside(template CacheTemplate, opts ...AsideOption) *Aside {
+	aside := &Aside{template: template, expire: time.Minute * 10}
+	for _, opt := range opts {
+		opt(aside)
+	}
+	if aside.expire < 0 {
+		aside.expire = 0
+	}
+	return aside
+}
+
+// Get 读取一个缓存,未命中时通过load加载并写入缓存
+// 数据不存在时返回的 Reply.Absent() 为true,Err() 为 NotFoundErr;加载出错时返回该错误;写入缓存失败不影响返回的结果
+// load返回nil时缓存空字符串
+func (aside *Aside) Get(ctx context.Context, key string, load LoadFunc) *Reply {
+	template := BindContext(aside.template, ctx)
+	reply := template.Get(key)
+	if reply.tombstone() {
+		return absentReply(NotFoundErr)
+	}
+	if reply.Ok() || !errors.Is(reply.Err(), redis.Nil) {
+		return reply
+	}
+	if aside.filter != nil {
+		if ok, err := aside.filter.MightContain(ctx, key); err == nil && !ok {
+			return absentReply(NotFoundErr)
+		}
+	}
+	value, err := load(ctx, key)
+	if errors.Is(err, NotFoundErr) {
+		if aside.negativeTTL > 0 {
+			_ = template.SetExpire(key, Tombstone, aside.negativeTTL)
+		}
+		return absentReply(err)
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	body, err := EncodeValue(value)
+	if err != nil {
+		return errReply(err)
+	}
+	_ = template.SetExpire(key, body, aside.expire)
+	return NewReply(redis.NewStringResult(body, nil))
+}
+
+// 构造一个错误响应
+func errReply(err error) *Reply {
+	return NewReply(redis.NewStringResult("", err))
+}
+
+// 构造一个数据确定不存在的响应
+func absentReply(err error) *Reply {
+	reply := errReply(err)
+	reply.absent = true
+	return reply
+}
@@ -0,0 +1,151 @@
+/**
+  @author: Zero
+  @date: 2023/7/24 16:02:39
+  @desc: 旁路缓存单元测试
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+)
+
+// 基于集合的Key过滤器
+type setFilter map[string]bool
+
+func (filter setFilter) MightContain(_ context.Context, key string) (bool, error) {
+	return filter[key], nil
+}
+
+// 测试未命中时加载并写入缓存,命中时不再加载
+func TestAside_Get(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	template := NewMemoryTemplate()
+	aside := NewAside(template, WithLoadExpire(time.Minute))
+	loads := 0
+	load := func(ctx context.Context, key string) (any, error) {
+		loads++
+		return Student{Name: "zero", Age: 18}, nil
+	}
+
+	var student Student
+	reply := aside.Get(ctx, "aside:user:1", load)
+	is.True(reply.Ok())
+	is.NoError(reply.ToAny(&student))
+	is.Equal("zero", student.Name)
+	reply = aside.Get(ctx, "aside:user:1", load)
+	is.NoError(reply.ToAny(&student))
+	is.Equal(1, loads)
+	ttl, _ := template.GetExpire("aside:user:1")
+	is.Equal(time.Minute, ttl)
+
+	// 加载出错时不写入缓存
+	failed := errors.New("db down")
+	reply = aside.Get(ctx, "aside:user:2", func(ctx context.Context, key string) (any, error) {
+		return nil, failed
+	})
+	is.False(reply.Ok())
+	is.ErrorIs(reply.Err(), failed)
+	is.False(template.Exists("aside:user:2"))
+}
+
+// 测试加载函数返回nil时缓存空字符串,不再重复加载
+func TestAside_NilValue(t *testing.T) {
+	redisTemplate := newFakeTemplate(t)
+	for name, template := range map[string]CacheTemplate{
+		"Memory": NewMemoryTemplate(),
+		"Redis":  &redisTemplate,
+	} {
+		t.Run(name, func(t *testing.T) {
+			is := assert.New(t)
+			ctx := context.Background()
+			aside := NewAside(template)
+			loads := 0
+			load := func(ctx context.Context, key string) (any, error) {
+				loads++
+				return nil, nil
+			}
+			for i := 0; i < 2; i++ {
+				reply := aside.Get(ctx, "aside:nil", load)
+				is.True(reply.Ok())
+				is.Equal("", reply.GetString())
+			}
+			is.Equal(1, loads)
+		})
+	}
+}
+
+// 测试过滤器判断一定不存在的Key不会访问数据源
+func TestAside_KeyFilter(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	aside := NewAside(NewMemoryTemplate(), WithKeyFilter(setFilter{"aside:order:1": true}))
+	loads := 0
+	load := func(ctx context.Context, key string) (any, error) {
+		loads++
+		return "order", nil
+	}
+
+	reply := aside.Get(ctx, "aside:order:404", load)
+	is.ErrorIs(reply.Err(), NotFoundErr)
+	is.True(reply.Absent())
+	is.Equal(0, loads)
+	reply = aside.Get(ctx, "aside:order:1", load)
+	is.Equal("order", reply.GetString())
+	is.Equal(1, loads)
+}
+
+// 测试数据不存在时写入墓碑,墓碑有效期内不再访问数据源
+func TestAside_NegativeCache(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	template := NewMemoryTemplate()
+	template.Clock = fake
+	aside := NewAside(template, WithNegativeTTL(time.Second*30))
+	loads := 0
+	load := func(ctx context.Context, key string) (any, error) {
+		loads++
+		return nil, NotFoundErr
+	}
+
+	for i := 0; i < 3; i++ {
+		reply := aside.Get(ctx, "aside:user:404", load)
+		is.True(reply.Absent())
+		is.False(reply.Ok())
+		is.ErrorIs(reply.Err(), NotFoundErr)
+		is.Empty(reply.GetString())
+	}
+	is.Equal(1, loads)
+
+	// 直接读取得到墓碑值本身
+	reply := template.Get("aside:user:404")
+	is.False(reply.Absent())
+	is.Equal(Tombstone, reply.GetString())
+	ttl, _ := template.GetExpire("aside:user:404")
+	is.Equal(time.Second*30, ttl)
+
+	// 墓碑过期后重新加载
+	fake.Advance(time.Second * 30)
+	is.True(aside.Get(ctx, "aside:user:404", load).Absent())
+	is.Equal(2, loads)
+
+	// 未开启负缓存时不写入墓碑
+	aside = NewAside(template)
+	is.True(aside.Get(ctx, "aside:user:405", load).Absent())
+	is.False(template.Exists("aside:user:405"))
+
+	// 未命中不是确定不存在
+	reply = template.Get("aside:user:405")
+	is.False(reply.Absent())
+	is.ErrorIs(reply.Err(), redis.Nil)
+}
@@ -0,0 +1,419 @@
+/**
+  @author: Zero
+  @date: 2023/7/18 09:50:14
+  @desc: CacheTemplate 实现的一致性测试套件
+
+**/
+
+package cachetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/caches"
+)
+
+// Factory 创建一个待测试的缓存模板,同一次 Run 中多次调用可以返回同一个实例
+type Factory func(t *testing.T) caches.CacheTemplate
+
+// Run 对一个 CacheTemplate 实现运行一致性测试
+// 每个测试使用独立的Key前缀,可以与其他测试共用同一个后端
+func Run(t *testing.T, factory Factory) {
+	t.Run("Miss", func(t *testing.T) { testMiss(t, factory(t), prefix(t)) })
+	t.Run("SetGet", func(t *testing.T) { testSetGet(t, factory(t), prefix(t)) })
+	t.Run("StructRoundTrip", func(t *testing.T) { testStructRoundTrip(t, factory(t), prefix(t)) })
+	t.Run("Del", func(t *testing.T) { testDel(t, factory(t), prefix(t)) })
+	t.Run("TTL", func(t *testing.T) { testTTL(t, factory(t), prefix(t)) })
+	t.Run("Expiry", func(t *testing.T) { testExpiry(t, factory(t), prefix(t)) })
+	t.Run("ExpireAdd", func(t *testing.T) { testExpireAdd(t, factory(t), prefix(t)) })
+	t.Run("ExpireSetup", func(t *testing.T) { testExpireSetup(t, factory(t), prefix(t)) })
+	t.Run("Keys", func(t *testing.T) { testKeys(t, factory(t), prefix(t)) })
+	t.Run("MSet", func(t *testing.T) { testMSet(t, factory(t), prefix(t)) })
+	t.Run("Tombstone", func(t *testing.T) { testTombstone(t, factory(t), prefix(t)) })
+	t.Run("Counter", func(t *testing.T) { testCounter(t, factory(t), prefix(t)) })
+	t.Run("CounterTTL", func(t *testing.T) { testCounterTTL(t, factory(t), prefix(t)) })
+	t.Run("CounterBounds", func(t *testing.T) { testCounterBounds(t, factory(t), prefix(t)) })
+}
+
+// 每个测试独立的Key前缀
+func prefix(t *testing.T) string {
+	return fmt.Sprintf("cachetest:%s:%d:", t.Name(), time.Now().UnixNano())
+}
+
+// 测试读取不存在的Key
+func testMiss(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	key := prefix + "missing"
+	reply := template.Get(key)
+	is.False(reply.Ok())
+	is.Error(reply.Err())
+	is.Empty(reply.GetString())
+	is.False(template.Exists(key))
+	ttl, err := template.GetExpire(key)
+	is.NoError(err)
+	is.Equal(time.Duration(-2), ttl)
+	is.False(template.ExpireAdd(key, time.Second))
+	is.False(template.ExpireSetup(key, time.Now().Add(time.Second)))
+}
+
+// 测试设置与读取基础类型
+func testSetGet(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.Set(prefix+"string", "hello"))
+	is.NoError(template.Set(prefix+"int", 123))
+	is.NoError(template.Set(prefix+"float", 1.5))
+	is.NoError(template.Set(prefix+"bytes", []byte("raw")))
+
+	reply := template.Get(prefix + "string")
+	is.True(reply.Ok())
+	is.NoError(reply.Err())
+	is.Equal("hello", reply.GetString())
+	is.Equal("123", template.Get(prefix+"int").GetString())
+	is.Equal("1.5", template.Get(prefix+"float").GetString())
+	is.Equal([]byte("raw"), template.Get(prefix+"bytes").GetBytes())
+	is.True(template.Exists(prefix + "string"))
+
+	// 覆盖已有的值
+	is.NoError(template.Set(prefix+"string", "world"))
+	is.Equal("world", template.Get(prefix+"string").GetString())
+}
+
+type user struct {
+	Name   string
+	Age    int
+	Tags   []string
+	Scores map[string]int
+}
+
+// 实现了 encoding.BinaryMarshaler 的结构体,与其他结构体一样序列化为Json
+type version struct {
+	Major int
+	Minor int
+}
+
+func (v version) MarshalBinary() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+// 实现了 encoding.BinaryMarshaler 的非结构体类型,通过 MarshalBinary 序列化
+type level int
+
+func (l level) MarshalBinary() ([]byte, error) {
+	return []byte(fmt.Sprintf("level-%d", l)), nil
+}
+
+// 测试结构体、切片、Map通过 Reply.ToAny 还原
+func testStructRoundTrip(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	want := user{Name: "zero", Age: 18, Tags: []string{"a", "b"}, Scores: map[string]int{"go": 100}}
+	is.NoError(template.Set(prefix+"struct", want))
+	var got user
+	is.NoError(template.Get(prefix + "struct").ToAny(&got))
+	is.Equal(want, got)
+
+	is.NoError(template.Set(prefix+"slice", []int{1, 2, 3}))
+	var list []int
+	is.NoError(template.Get(prefix + "slice").ToAny(&list))
+	is.Equal([]int{1, 2, 3}, list)
+
+	is.NoError(template.Set(prefix+"map", map[string]string{"k": "v"}))
+	var m map[string]string
+	is.NoError(template.Get(prefix + "map").ToAny(&m))
+	is.Equal(map[string]string{"k": "v"}, m)
+
+	// time.Time 与其他结构体一样序列化为Json字符串
+	at := time.Date(2023, 7, 18, 9, 50, 14, 123, time.UTC)
+	is.NoError(template.Set(prefix+"time", at))
+	is.Equal(`"2023-07-18T09:50:14.000000123Z"`, template.Get(prefix+"time").GetString())
+	var gotAt time.Time
+	is.NoError(template.Get(prefix + "time").ToAny(&gotAt))
+	is.True(at.Equal(gotAt))
+
+	is.NoError(template.Set(prefix+"version", version{Major: 1, Minor: 2}))
+	is.Equal(`{"Major":1,"Minor":2}`, template.Get(prefix+"version").GetString())
+	var gotVersion version
+	is.NoError(template.Get(prefix + "version").ToAny(&gotVersion))
+	is.Equal(version{Major: 1, Minor: 2}, gotVersion)
+
+	is.NoError(template.Set(prefix+"level", level(3)))
+	is.Equal("level-3", template.Get(prefix+"level").GetString())
+}
+
+// 测试删除一个或多个Key,删除不存在的Key不返回错误
+func testDel(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.Set(prefix+"a", 1))
+	is.NoError(template.Set(prefix+"b", 2))
+	is.NoError(template.Del(prefix+"a", prefix+"b", prefix+"missing"))
+	is.False(template.Exists(prefix + "a"))
+	is.False(template.Exists(prefix + "b"))
+	is.NoError(template.Del(prefix + "missing"))
+}
+
+// 测试剩余有效期,永不过期的Key返回-1
+func testTTL(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.Set(prefix+"forever", 1))
+	ttl, err := template.GetExpire(prefix + "forever")
+	is.NoError(err)
+	is.Equal(time.Duration(-1), ttl)
+
+	is.NoError(template.SetExpire(prefix+"ttl", 1, time.Second*100))
+	ttl, err = template.GetExpire(prefix + "ttl")
+	is.NoError(err)
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+
+	// 重新设置不带有效期的值后永不过期
+	is.NoError(template.Set(prefix+"ttl", 2))
+	ttl, _ = template.GetExpire(prefix + "ttl")
+	is.Equal(time.Duration(-1), ttl)
+}
+
+// 测试有效期到达后Key自动失效
+func testExpiry(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.SetExpire(prefix+"short", 1, time.Millisecond*200))
+	is.True(template.Exists(prefix + "short"))
+	time.Sleep(time.Millisecond * 400)
+	is.False(template.Exists(prefix + "short"))
+	is.False(template.Get(prefix + "short").Ok())
+}
+
+// 测试 ExpireAdd 将剩余有效期设置为从现在开始的时长
+func testExpireAdd(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.SetExpire(prefix+"key", 1, time.Second*10))
+	is.True(template.ExpireAdd(prefix+"key", time.Second*100))
+	ttl, err := template.GetExpire(prefix + "key")
+	is.NoError(err)
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+
+	// 永不过期的Key设置有效期
+	is.NoError(template.Set(prefix+"forever", 1))
+	is.True(template.ExpireAdd(prefix+"forever", time.Second*50))
+	ttl, _ = template.GetExpire(prefix + "forever")
+	is.InDelta(time.Second*50, ttl, float64(time.Second))
+}
+
+// 测试 ExpireSetup 将有效期设置为指定的时间点,时间点已过去时删除Key
+func testExpireSetup(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.Set(prefix+"key", 1))
+	is.True(template.ExpireSetup(prefix+"key", time.Now().Add(time.Second*100)))
+	ttl, err := template.GetExpire(prefix + "key")
+	is.NoError(err)
+	is.InDelta(time.Second*100, ttl, float64(time.Second*2))
+
+	is.True(template.ExpireSetup(prefix+"key", time.Now().Add(-time.Second)))
+	is.False(template.Exists(prefix + "key"))
+}
+
+// 测试Key的通配符规则
+func testKeys(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	for _, key := range []string{"a1", "a2", "b1", "ab"} {
+		is.NoError(template.Set(prefix+key, 1))
+	}
+	match := func(pattern string) []string {
+		keys := template.Keys(prefix + pattern)
+		sort.Strings(keys)
+		return keys
+	}
+	is.Equal([]string{prefix + "a1", prefix + "a2", prefix + "ab"}, match("a*"))
+	is.Equal([]string{prefix + "a1", prefix + "b1"}, match("?1"))
+	is.Equal([]string{prefix + "a1", prefix + "a2"}, match("a[12]"))
+	is.Equal([]string{prefix + "ab"}, match("a[^0-9]"))
+	is.Len(match("*"), 4)
+	is.Empty(match("c*"))
+}
+
+// 测试计数器的增减,不存在的计数器视为0,非数字的值不能参与计数
+func testCounter(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	n, err := template.Incr(prefix + "count")
+	is.NoError(err)
+	is.Equal(int64(1), n)
+	n, err = template.IncrBy(prefix+"count", 5)
+	is.NoError(err)
+	is.Equal(int64(6), n)
+	n, err = template.Decr(prefix + "count")
+	is.NoError(err)
+	is.Equal(int64(5), n)
+	is.Equal("5", template.Get(prefix+"count").GetString())
+
+	f, err := template.IncrByFloat(prefix+"count", 0.5)
+	is.NoError(err)
+	is.Equal(5.5, f)
+	_, err = template.Incr(prefix + "count")
+	is.Error(err)
+
+	n, err = template.Decr(prefix + "negative")
+	is.NoError(err)
+	is.Equal(int64(-1), n)
+
+	is.NoError(template.Set(prefix+"text", "abc"))
+	_, err = template.Incr(prefix + "text")
+	is.Error(err)
+	_, err = template.IncrByFloat(prefix+"text", 1)
+	is.Error(err)
+	_, err = template.Incr(prefix+"text", caches.WithFloor(0))
+	is.Error(err)
+	is.Equal("abc", template.Get(prefix+"text").GetString())
+}
+
+// 测试计数器只在首次创建时设置有效期
+func testCounterTTL(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	n, err := template.Incr(prefix+"count", caches.WithCounterTTL(time.Second*100))
+	is.NoError(err)
+	is.Equal(int64(1), n)
+	ttl, _ := template.GetExpire(prefix + "count")
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+
+	n, err = template.IncrBy(prefix+"count", 2, caches.WithCounterTTL(time.Second*10))
+	is.NoError(err)
+	is.Equal(int64(3), n)
+	ttl, _ = template.GetExpire(prefix + "count")
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+
+	f, err := template.IncrByFloat(prefix+"float", 1.5, caches.WithCounterTTL(time.Second*50))
+	is.NoError(err)
+	is.Equal(1.5, f)
+	ttl, _ = template.GetExpire(prefix + "float")
+	is.InDelta(time.Second*50, ttl, float64(time.Second))
+
+	// 已存在的永不过期的计数器保持永不过期
+	is.NoError(template.Set(prefix+"forever", 1))
+	_, err = template.Incr(prefix+"forever", caches.WithCounterTTL(time.Second*10))
+	is.NoError(err)
+	ttl, _ = template.GetExpire(prefix + "forever")
+	is.Equal(time.Duration(-1), ttl)
+}
+
+// 测试计数器的上下限,超出范围时计数器保持不变
+func testCounterBounds(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	key := prefix + "stock"
+	n, err := template.Decr(key, caches.WithFloor(0))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(int64(0), n)
+	is.False(template.Exists(key))
+
+	n, err = template.IncrBy(key, 2, caches.WithFloor(0), caches.WithCap(3))
+	is.NoError(err)
+	is.Equal(int64(2), n)
+	n, err = template.IncrBy(key, 2, caches.WithFloor(0), caches.WithCap(3))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(int64(2), n)
+	n, err = template.Incr(key, caches.WithCap(3))
+	is.NoError(err)
+	is.Equal(int64(3), n)
+
+	for i := int64(2); i >= 0; i-- {
+		n, err = template.Decr(key, caches.WithFloor(0))
+		is.NoError(err)
+		is.Equal(i, n)
+	}
+	n, err = template.Decr(key, caches.WithFloor(0))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(int64(0), n)
+	is.Equal("0", template.Get(key).GetString())
+
+	// 大于等于1e14的计数器
+	n, err = template.IncrBy(prefix+"large", 100_000_000_000_000, caches.WithFloor(0))
+	is.NoError(err)
+	is.Equal(int64(100_000_000_000_000), n)
+	n, err = template.Incr(prefix+"large", caches.WithFloor(0))
+	is.NoError(err)
+	is.Equal(int64(100_000_000_000_001), n)
+	n, err = template.Incr(prefix+"large", caches.WithCap(100_000_000_000_001))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(int64(100_000_000_000_001), n)
+
+	f, err := template.IncrByFloat(prefix+"balance", 10.5, caches.WithCap(10))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(float64(0), f)
+	f, err = template.IncrByFloat(prefix+"balance", 9.5, caches.WithCap(10))
+	is.NoError(err)
+	is.Equal(9.5, f)
+	f, err = template.IncrByFloat(prefix+"balance", -10, caches.WithFloor(0))
+	is.ErrorIs(err, caches.CounterOutOfRangeErr)
+	is.Equal(9.5, f)
+}
+
+// 测试墓碑对模板而言是普通的值,通过 Aside 读取墓碑得到确定不存在,既不是未命中也不是有效值
+func testTombstone(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	ctx := context.Background()
+	is.NoError(template.SetExpire(prefix+"absent", caches.Tombstone, time.Second*100))
+	reply := template.Get(prefix + "absent")
+	is.True(reply.Ok())
+	is.False(reply.Absent())
+	is.Equal(caches.Tombstone, reply.GetString())
+
+	loads := 0
+	aside := caches.NewAside(template)
+	load := func(ctx context.Context, key string) (any, error) {
+		loads++
+		return "value", nil
+	}
+	reply = aside.Get(ctx, prefix+"absent", load)
+	is.True(reply.Absent())
+	is.False(reply.Ok())
+	is.ErrorIs(reply.Err(), caches.NotFoundErr)
+	is.Empty(reply.GetString())
+	is.Zero(loads)
+	is.True(template.Exists(prefix + "absent"))
+
+	is.False(template.Get(prefix + "missing").Absent())
+	is.NoError(template.Set(prefix+"absent", "value"))
+	reply = aside.Get(ctx, prefix+"absent", load)
+	is.False(reply.Absent())
+	is.Equal("value", reply.GetString())
+	is.Zero(loads)
+}
+
+// 测试批量设置缓存,每个缓存有各自的有效期
+func testMSet(t *testing.T, template caches.CacheTemplate, prefix string) {
+	is := assert.New(t)
+	is.NoError(template.MSet())
+	is.NoError(template.MSet(
+		caches.Item{Key: prefix + "string", Value: "hello", Expire: time.Second * 100},
+		caches.Item{Key: prefix + "int", Value: 123},
+		caches.Item{Key: prefix + "struct", Value: user{Name: "zero", Age: 18}, Expire: time.Second * 50},
+	))
+	is.Equal("hello", template.Get(prefix+"string").GetString())
+	is.Equal("123", template.Get(prefix+"int").GetString())
+	var got user
+	is.NoError(template.Get(prefix + "struct").ToAny(&got))
+	is.Equal("zero", got.Name)
+
+	ttl, _ := template.GetExpire(prefix + "string")
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+	ttl, _ = template.GetExpire(prefix + "int")
+	is.Equal(time.Duration(-1), ttl)
+	ttl, _ = template.GetExpire(prefix + "struct")
+	is.InDelta(time.Second*50, ttl, float64(time.Second))
+
+	// 保留原有效期,不存在的Key永不过期;nil值写入空字符串
+	is.NoError(template.MSet(
+		caches.Item{Key: prefix + "string", Value: "world", Expire: redis.KeepTTL},
+		caches.Item{Key: prefix + "keep", Value: "new", Expire: redis.KeepTTL},
+		caches.Item{Key: prefix + "nil", Value: nil, Expire: time.Second * 100},
+	))
+	is.Equal("world", template.Get(prefix+"string").GetString())
+	ttl, _ = template.GetExpire(prefix + "string")
+	is.InDelta(time.Second*100, ttl, float64(time.Second))
+	is.Equal("new", template.Get(prefix+"keep").GetString())
+	ttl, _ = template.GetExpire(prefix + "keep")
+	is.Equal(time.Duration(-1), ttl)
+	reply := template.Get(prefix + "nil")
+	is.True(reply.Ok())
+	is.Equal("", reply.GetString())
+}
@@ -0,0 +1,495 @@
+/**
+  @author: Zero
+  @date: 2023/7/19 10:22:48
+  @desc: 故障注入,用于测试缓存慢、缓存不可用时的降级逻辑
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/clock"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ChaosErr 注入的默认错误
+	ChaosErr = errors.New("chaos: injected failure")
+	// ChaosTimeoutErr 注入的超时错误,同时满足 errors.Is(err, context.DeadlineExceeded)
+	ChaosTimeoutErr = fmt.Errorf("chaos: injected timeout: %w", context.DeadlineExceeded)
+)
+
+// Fault 一条规则注入的故障,各项故障按 延迟 -> 超时 -> 错误 -> 丢弃写入 的顺序依次判断
+type Fault struct {
+	// 固定延迟
+	Latency time.Duration
+	// 在固定延迟之外增加[0,Jitter)的随机延迟
+	Jitter time.Duration
+	// 模拟超时的概率,取值[0,1]
+	TimeoutRate float64
+	// 模拟超时时等待的时长,等待结束或者ctx结束后返回 ChaosTimeoutErr
+	Timeout time.Duration
+	// 返回错误的概率,取值[0,1]
+	ErrorRate float64
+	// 返回的错误,为nil时返回 ChaosErr
+	Err error
+	// 丢弃写操作的概率,取值[0,1],被丢弃的写操作直接返回成功
+	// 计数器操作没有可以伪造的结果,被丢弃时返回 Err
+	DropRate float64
+}
+
+// 注入的错误
+func (fault *Fault) error() error {
+	if fault.Err != nil {
+		return fault.Err
+	}
+	return ChaosErr
+}
+
+// 操作类型,决定写操作被丢弃时的行为
+type chaosOp int
+
+const (
+	// 读操作,不会被丢弃
+	chaosRead chaosOp = iota
+	// 写操作,被丢弃时直接返回成功
+	chaosWrite
+	// 计数器操作,被丢弃时返回注入的错误
+	chaosCounter
+)
+
+// Rule 故障注入规则
+type Rule struct {
+	// 生效的操作,模板方法名(例如`Get`、`SetExpire`)或者Redis命令名(例如`get`、`evalsha`),不区分大小写
+	// 为空表示所有操作
+	Ops []string
+	// 生效的Key规则,与Redis KEYS命令的通配符一致,为空表示所有Key
+	KeyPattern string
+	// 注入的故障
+	Fault
+}
+
+// 规则是否匹配本次操作
+func (rule *Rule) match(op string, keys []string) bool {
+	if len(rule.Ops) > 0 {
+		matched := false
+		for _, o := range rule.Ops {
+			if strings.EqualFold(o, op) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rule.KeyPattern == "" {
+		return true
+	}
+	for _, key := range keys {
+		if MatchPattern(rule.KeyPattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Chaos 故障注入器,可以通过 NewChaosTemplate 装饰任意缓存模板,
+// 或者通过 Hook 安装到Redis客户端上(例如分布式锁使用的模板)
+// 创建后默认启用,可以在运行时通过 Enable、Disable 开关,通过 SetRules 替换规则
+type Chaos struct {
+	// 时钟,用于注入延迟与超时,为nil时使用系统时钟
+	Clock clock.Clock
+	// 是否启用
+	enabled atomic.Bool
+	mu      sync.Mutex
+	// 注入规则,按顺序匹配第一条
+	rules []Rule
+	// 随机数
+	rand *rand.Rand
+}
+
+// NewChaos 创建一个故障注入器
+func NewChaos(rules ...Rule) *Chaos {
+	chaos := &Chaos{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	chaos.enabled.Store(true)
+	return chaos
+}
+
+// Enable 启用故障注入
+func (chaos *Chaos) Enable() {
+	chaos.enabled.Store(true)
+}
+
+// Disable 关闭故障注入,所有操作直接交给被装饰的模板
+func (chaos *Chaos) Disable() {
+	chaos.enabled.Store(false)
+}
+
+// Enabled 是否启用故障注入
+func (chaos *Chaos) Enabled() bool {
+	return chaos.enabled.Load()
+}
+
+// SetRules 替换所有规则
+func (chaos *Chaos) SetRules(rules ...Rule) {
+	chaos.mu.Lock()
+	defer chaos.mu.Unlock()
+	chaos.rules = rules
+}
+
+// Seed 设置随机数种子,使概率故障可以复现
+func (chaos *Chaos) Seed(seed int64) {
+	chaos.mu.Lock()
+	defer chaos.mu.Unlock()
+	chaos.rand = rand.New(rand.NewSource(seed))
+}
+
+// 查找匹配本次操作的故障,并提前决定各项概率故障是否发生
+func (chaos *Chaos) decide(op string, keys []string) (fault Fault, timeout, fail, drop bool, ok bool) {
+	if !chaos.Enabled() {
+		return
+	}
+	chaos.mu.Lock()
+	defer chaos.mu.Unlock()
+	for i := range chaos.rules {
+		rule := &chaos.rules[i]
+		if !rule.match(op, keys) {
+			continue
+		}
+		fault = rule.Fault
+		if fault.Jitter > 0 {
+			fault.Latency += time.Duration(chaos.rand.Int63n(int64(fault.Jitter)))
+		}
+		timeout = chaos.hit(fault.TimeoutRate)
+		fail = chaos.hit(fault.ErrorRate)
+		drop = chaos.hit(fault.DropRate)
+		return fault, timeout, fail, drop, true
+	}
+	return
+}
+
+// 按概率判断是否发生,调用方需持有 mu
+func (chaos *Chaos) hit(rate float64) bool {
+	return rate > 0 && chaos.rand.Float64() < rate
+}
+
+// 等待d或者ctx结束
+func (chaos *Chaos) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.OrReal(chaos.Clock).After(d):
+		return nil
+	}
+}
+
+// 对一次操作注入故障
+// 返回注入的错误,以及写操作是否应被丢弃
+func (chaos *Chaos) inject(ctx context.Context, op string, keys []string, kind chaosOp) (dropped bool, err error) {
+	fault, timeout, fail, drop, ok := chaos.decide(op, keys)
+	if !ok {
+		return false, nil
+	}
+	if err = chaos.wait(ctx, fault.Latency); err != nil {
+		return false, err
+	}
+	if timeout {
+		if err = chaos.wait(ctx, fault.Timeout); err != nil {
+			return false, err
+		}
+		return false, ChaosTimeoutErr
+	}
+	if fail {
+		return false, fault.error()
+	}
+	if !drop {
+		return false, nil
+	}
+	switch kind {
+	case chaosWrite:
+		return true, nil
+	case chaosCounter:
+		return false, fault.error()
+	}
+	return false, nil
+}
+
+// ChaosTemplate 为任意缓存模板注入故障的装饰器
+type ChaosTemplate struct {
+	// 被装饰的缓存模板
+	template CacheTemplate
+	// 故障注入器
+	chaos *Chaos
+	// 调用方上下文,用于中断注入的延迟
+	ctx context.Context
+}
+
+// NewChaosTemplate 使用故障注入器装饰一个缓存模板
+func NewChaosTemplate(template CacheTemplate, chaos *Chaos) *ChaosTemplate {
+	return &ChaosTemplate{
+		template: template,
+		chaos:    chaos,
+		ctx:      defaultCtx,
+	}
+}
+
+// WithContext 返回一个绑定了ctx的模板副本,被装饰的模板同样会绑定ctx
+func (c *ChaosTemplate) WithContext(ctx context.Context) CacheTemplate {
+	return &ChaosTemplate{
+		template: BindContext(c.template, ctx),
+		chaos:    c.chaos,
+		ctx:      ctx,
+	}
+}
+
+// Set 设置一个缓存
+func (c *ChaosTemplate) Set(key string, value any) error {
+	if dropped, err := c.chaos.inject(c.ctx, "Set", []string{key}, chaosWrite); err != nil || dropped {
+		return err
+	}
+	return c.template.Set(key, value)
+}
+
+// SetExpire 设置一个带有有效时间的缓存
+func (c *ChaosTemplate) SetExpire(key string, value any, expire time.Duration) error {
+	if dropped, err := c.chaos.inject(c.ctx, "SetExpire", []string{key}, chaosWrite); err != nil || dropped {
+		return err
+	}
+	return c.template.SetExpire(key, value, expire)
+}
+
+// Get 根据Key读取一个缓存
+func (c *ChaosTemplate) Get(key string) *Reply {
+	if _, err := c.chaos.inject(c.ctx, "Get", []string{key}, chaosRead); err != nil {
+		return NewReply(redis.NewStringResult("", err))
+	}
+	return c.template.Get(key)
+}
+
+// Del 删除一个或多个缓存
+func (c *ChaosTemplate) Del(keys ...string) error {
+	if dropped, err := c.chaos.inject(c.ctx, "Del", keys, chaosWrite); err != nil || dropped {
+		return err
+	}
+	return c.template.Del(keys...)
+}
+
+// Exists 检查一个缓存是否存在,注入错误时返回false
+func (c *ChaosTemplate) Exists(key string) bool {
+	if _, err := c.chaos.inject(c.ctx, "Exists", []string{key}, chaosRead); err != nil {
+		return false
+	}
+	return c.template.Exists(key)
+}
+
+// Keys 匹配所有符合规则的Key,注入错误时返回空列表
+func (c *ChaosTemplate) Keys(pattern string) []string {
+	if _, err := c.chaos.inject(c.ctx, "Keys", []string{pattern}, chaosRead); err != nil {
+		return []string{}
+	}
+	return c.template.Keys(pattern)
+}
+
+// ExpireAdd 延长一个缓存的有效期,注入错误时返回false
+func (c *ChaosTemplate) ExpireAdd(key string, expire time.Duration) bool {
+	dropped, err := c.chaos.inject(c.ctx, "ExpireAdd", []string{key}, chaosWrite)
+	if err != nil {
+		return false
+	}
+	if dropped {
+		return true
+	}
+	return c.template.ExpireAdd(key, expire)
+}
+
+// ExpireSetup 设置有效期为指定时间,注入错误时返回false
+func (c *ChaosTemplate) ExpireSetup(key string, at time.Time) bool {
+	dropped, err := c.chaos.inject(c.ctx, "ExpireSetup", []string{key}, chaosWrite)
+	if err != nil {
+		return false
+	}
+	if dropped {
+		return true
+	}
+	return c.template.ExpireSetup(key, at)
+}
+
+// GetExpire 获取一个Key的剩余有效期
+func (c *ChaosTemplate) GetExpire(key string) (time.Duration, error) {
+	if _, err := c.chaos.inject(c.ctx, "GetExpire", []string{key}, chaosRead); err != nil {
+		return 0, err
+	}
+	return c.template.GetExpire(key)
+}
+
+// MSet 批量设置缓存
+func (c *ChaosTemplate) MSet(items ...Item) error {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	if dropped, err := c.chaos.inject(c.ctx, "MSet", keys, chaosWrite); err != nil || dropped {
+		return err
+	}
+	return c.template.MSet(items...)
+}
+
+// Incr 将计数器加1,写操作被丢弃时返回注入的错误
+func (c *ChaosTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	if _, err := c.chaos.inject(c.ctx, "Incr", []string{key}, chaosCounter); err != nil {
+		return 0, err
+	}
+	return c.template.Incr(key, opts...)
+}
+
+// IncrBy 将计数器增加delta,写操作被丢弃时返回注入的错误
+func (c *ChaosTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	if _, err := c.chaos.inject(c.ctx, "IncrBy", []string{key}, chaosCounter); err != nil {
+		return 0, err
+	}
+	return c.template.IncrBy(key, delta, opts...)
+}
+
+// IncrByFloat 将计数器增加浮点数delta,写操作被丢弃时返回注入的错误
+func (c *ChaosTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	if _, err := c.chaos.inject(c.ctx, "IncrByFloat", []string{key}, chaosCounter); err != nil {
+		return 0, err
+	}
+	return c.template.IncrByFloat(key, delta, opts...)
+}
+
+// Decr 将计数器减1,写操作被丢弃时返回注入的错误
+func (c *ChaosTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	if _, err := c.chaos.inject(c.ctx, "Decr", []string{key}, chaosCounter); err != nil {
+		return 0, err
+	}
+	return c.template.Decr(key, opts...)
+}
+
+// Hook 返回一个Redis客户端钩子,为经过该客户端的每条命令注入故障
+// 规则中的操作名为Redis命令名,例如 `template.Client.AddHook(chaos.Hook())` 后分布式锁的加锁脚本可以通过 `evalsha` 匹配
+func (chaos *Chaos) Hook() redis.Hook {
+	return chaosHook{chaos}
+}
+
+// 写命令,被丢弃时直接返回成功,计数器命令被丢弃时返回注入的错误
+var chaosWriteCommands = map[string]chaosOp{
+	"set": chaosWrite, "setnx": chaosWrite, "setex": chaosWrite, "psetex": chaosWrite, "del": chaosWrite, "unlink": chaosWrite,
+	"expire": chaosWrite, "pexpire": chaosWrite, "expireat": chaosWrite, "pexpireat": chaosWrite,
+	"incr": chaosCounter, "incrby": chaosCounter, "incrbyfloat": chaosCounter, "decr": chaosCounter, "decrby": chaosCounter,
+	"hset": chaosWrite, "hdel": chaosWrite, "setbit": chaosWrite,
+}
+
+type chaosHook struct {
+	chaos *Chaos
+}
+
+func (h chaosHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h chaosHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := cmd.Name()
+		dropped, err := h.chaos.inject(ctx, name, commandKeys(cmd), chaosWriteCommands[name])
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		if dropped {
+			dropReply(cmd)
+			return nil
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h chaosHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		// 被丢弃的写命令不再发送,事务的MULTI、EXEC不属于写命令,总是保留
+		kept := make([]redis.Cmder, 0, len(cmds))
+		// 除MULTI、EXEC以外仍需发送的命令数量
+		pending := 0
+		for _, cmd := range cmds {
+			name := cmd.Name()
+			dropped, err := h.chaos.inject(ctx, name, commandKeys(cmd), chaosWriteCommands[name])
+			if err != nil {
+				for _, c := range cmds {
+					c.SetErr(err)
+				}
+				return err
+			}
+			if dropped {
+				dropReply(cmd)
+				continue
+			}
+			kept = append(kept, cmd)
+			if name != "multi" && name != "exec" {
+				pending++
+			}
+		}
+		if pending == 0 {
+			// 全部被丢弃,go-redis不支持发送空事务
+			return nil
+		}
+		return next(ctx, kept)
+	}
+}
+
+// 获取命令操作的Key
+func commandKeys(cmd redis.Cmder) []string {
+	args := cmd.Args()
+	switch cmd.Name() {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		// EVAL script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return nil
+		}
+		n, _ := strconv.Atoi(fmt.Sprint(args[2]))
+		keys := make([]string, 0, n)
+		for i := 3; i < 3+n && i < len(args); i++ {
+			keys = append(keys, fmt.Sprint(args[i]))
+		}
+		return keys
+	case "del", "unlink", "exists":
+		keys := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			keys = append(keys, fmt.Sprint(arg))
+		}
+		return keys
+	}
+	if len(args) > 1 {
+		return []string{fmt.Sprint(args[1])}
+	}
+	return nil
+}
+
+// 为被丢弃的写命令设置成功的响应
+func dropReply(cmd redis.Cmder) {
+	switch c := cmd.(type) {
+	case *redis.StatusCmd:
+		c.SetVal("OK")
+	case *redis.IntCmd:
+		c.SetVal(1)
+	case *redis.BoolCmd:
+		c.SetVal(true)
+	case *redis.FloatCmd:
+		c.SetVal(0)
+	}
+}
@@ -0,0 +1,105 @@
+/**
+  @author: Zero
+  @date: 2023/7/19 11:30:16
+  @desc: 故障注入单元测试
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试按操作与Key规则注入错误,以及运行时开关
+func TestChaosTemplate_Error(t *testing.T) {
+	is := assert.New(t)
+	chaos := NewChaos(Rule{Ops: []string{"Get", "Exists"}, KeyPattern: "chaos:user:*", Fault: Fault{ErrorRate: 1}})
+	template := NewChaosTemplate(NewMemoryTemplate(), chaos)
+	is.NoError(template.Set("chaos:user:1", "zero"))
+	is.NoError(template.Set("chaos:order:1", "order"))
+
+	is.ErrorIs(template.Get("chaos:user:1").Err(), ChaosErr)
+	is.False(template.Exists("chaos:user:1"))
+	is.Equal("order", template.Get("chaos:order:1").GetString())
+
+	chaos.Disable()
+	is.Equal("zero", template.Get("chaos:user:1").GetString())
+	chaos.Enable()
+	chaos.SetRules()
+	is.True(template.Exists("chaos:user:1"))
+}
+
+// 测试丢弃写操作
+func TestChaosTemplate_DropWrites(t *testing.T) {
+	is := assert.New(t)
+	chaos := NewChaos(Rule{Fault: Fault{DropRate: 1}})
+	memory := NewMemoryTemplate()
+	template := NewChaosTemplate(memory, chaos)
+	is.NoError(template.Set("chaos:dropped", 1))
+	is.False(memory.Exists("chaos:dropped"))
+	is.True(template.ExpireAdd("chaos:dropped", time.Second))
+
+	// 计数器没有可以伪造的结果,被丢弃时返回注入的错误
+	_, err := template.Incr("chaos:counter")
+	is.ErrorIs(err, ChaosErr)
+	is.False(memory.Exists("chaos:counter"))
+	custom := errors.New("counter dropped")
+	chaos.SetRules(Rule{Fault: Fault{DropRate: 1, Err: custom}})
+	_, err = template.IncrByFloat("chaos:counter", 1.5)
+	is.ErrorIs(err, custom)
+}
+
+// 测试注入延迟与超时,超时受调用方ctx控制
+func TestChaosTemplate_LatencyAndTimeout(t *testing.T) {
+	is := assert.New(t)
+	chaos := NewChaos(Rule{Ops: []string{"Get"}, Fault: Fault{Latency: time.Millisecond * 50}})
+	template := NewChaosTemplate(NewMemoryTemplate(), chaos)
+	start := time.Now()
+	template.Get("chaos:slow")
+	is.GreaterOrEqual(time.Since(start), time.Millisecond*50)
+
+	chaos.SetRules(Rule{Fault: Fault{TimeoutRate: 1, Timeout: time.Second}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	start = time.Now()
+	is.ErrorIs(template.WithContext(ctx).Set("chaos:slow", 1), context.DeadlineExceeded)
+	is.Less(time.Since(start), time.Second)
+}
+
+// 测试通过客户端钩子为Redis命令注入故障
+func TestChaos_Hook(t *testing.T) {
+	is := assert.New(t)
+	template := newFakeTemplate(t)
+	chaos := NewChaos(Rule{Ops: []string{"evalsha", "set"}, KeyPattern: "chaos-hook:*", Fault: Fault{ErrorRate: 1}})
+	template.Client.AddHook(chaos.Hook())
+	ctx := context.Background()
+
+	script := NewScript("sugar_test_chaos", `return redis.call('get', KEYS[1])`)
+	_, err := template.EvalScript(ctx, script, []string{"chaos-hook:lock"}).Result()
+	is.ErrorIs(err, ChaosErr)
+	is.ErrorIs(template.Set("chaos-hook:key", 1), ChaosErr)
+	is.NoError(template.Set("chaos-other:key", 1))
+
+	chaos.SetRules(Rule{Ops: []string{"set"}, Fault: Fault{DropRate: 1}})
+	is.NoError(template.Set("chaos-hook:dropped", 1))
+	is.ErrorIs(template.Get("chaos-hook:dropped").Err(), redis.Nil)
+
+	// 事务中的写命令同样可以被丢弃,未被丢弃的命令正常执行
+	chaos.SetRules(Rule{Ops: []string{"set"}, KeyPattern: "chaos-hook:mset-dropped", Fault: Fault{DropRate: 1}})
+	is.NoError(template.MSet(Item{Key: "chaos-hook:mset-dropped", Value: 1}, Item{Key: "chaos-hook:mset-kept", Value: 2}))
+	is.False(template.Exists("chaos-hook:mset-dropped"))
+	is.Equal("2", template.Get("chaos-hook:mset-kept").GetString())
+
+	chaos.SetRules(Rule{Ops: []string{"set", "incrby"}, Fault: Fault{DropRate: 1}})
+	is.NoError(template.MSet(Item{Key: "chaos-hook:mset-all", Value: 1}))
+	is.False(template.Exists("chaos-hook:mset-all"))
+	_, err = template.Client.IncrBy(ctx, "chaos-hook:counter", 1).Result()
+	is.ErrorIs(err, ChaosErr)
+}
@@ -0,0 +1,44 @@
+/**
+  @author: Zero
+  @date: 2023/7/18 11:06:33
+  @desc: 对所有缓存模板实现运行一致性测试
+
+**/
+
+package caches_test
+
+import (
+	"testing"
+
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/caches/cachetest"
+	"github.com/zlx2019/sugar/internal/redisfake"
+	"github.com/zlx2019/sugar/metrics"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestConformance_Redis(t *testing.T) {
+	t.Parallel()
+	template := redisfake.New(t)
+	cachetest.Run(t, func(t *testing.T) caches.CacheTemplate {
+		return &template
+	})
+}
+
+func TestConformance_Memory(t *testing.T) {
+	t.Parallel()
+	template := caches.NewMemoryTemplate()
+	cachetest.Run(t, func(t *testing.T) caches.CacheTemplate {
+		return template
+	})
+}
+
+// 装饰器不能改变被装饰模板的语义
+func TestConformance_Decorators(t *testing.T) {
+	t.Parallel()
+	template := caches.NewMemoryTemplate()
+	cachetest.Run(t, func(t *testing.T) caches.CacheTemplate {
+		tracing := caches.NewTracingTemplate(caches.NewMetricsTemplate(template, metrics.Nop()), noop.NewTracerProvider().Tracer(""))
+		return caches.NewJitterTemplate(tracing, caches.NoJitter)
+	})
+}
@@ -0,0 +1,183 @@
+/**
+  @author: Zero
+  @date: 2023/7/23 10:06:48
+  @desc: 原子计数器
+
+**/
+
+package caches
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CounterOutOfRangeErr 本次增减会使计数器超出下限或者上限,计数器保持不变
+var CounterOutOfRangeErr = errors.New("counter would go out of range")
+
+// CounterOption 计数器选项
+type CounterOption func(options *counterOptions)
+
+type counterOptions struct {
+	// 计数器首次创建时设置的有效期,不大于0时永不过期
+	ttl time.Duration
+	// 下限
+	floor    float64
+	hasFloor bool
+	// 上限
+	cap    float64
+	hasCap bool
+}
+
+// WithCounterTTL 计数器首次创建时设置有效期,已存在的计数器保持原有效期
+func WithCounterTTL(ttl time.Duration) CounterOption {
+	return func(options *counterOptions) {
+		options.ttl = ttl
+	}
+}
+
+// WithFloor 设置计数器的下限,增减后低于下限时拒绝本次操作并返回 CounterOutOfRangeErr
+// 例如 WithFloor(0) 保证库存、配额等计数器不会变为负数
+func WithFloor(floor float64) CounterOption {
+	return func(options *counterOptions) {
+		options.floor, options.hasFloor = floor, true
+	}
+}
+
+// WithCap 设置计数器的上限,增减后高于上限时拒绝本次操作并返回 CounterOutOfRangeErr
+func WithCap(cap float64) CounterOption {
+	return func(options *counterOptions) {
+		options.cap, options.hasCap = cap, true
+	}
+}
+
+func newCounterOptions(opts []CounterOption) counterOptions {
+	var o counterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// 是否需要通过脚本执行
+func (o counterOptions) scripted() bool {
+	return o.ttl > 0 || o.hasFloor || o.hasCap
+}
+
+// 判断增减后的值是否在范围之内
+func (o counterOptions) inRange(value float64) bool {
+	return (!o.hasFloor || value >= o.floor) && (!o.hasCap || value <= o.cap)
+}
+
+// 脚本参数: 增量, 有效期毫秒数, 下限, 上限, 类型
+func (o counterOptions) args(delta string, kind string) []any {
+	var floor, cap string
+	if o.hasFloor {
+		floor = strconv.FormatFloat(o.floor, 'f', -1, 64)
+	}
+	if o.hasCap {
+		cap = strconv.FormatFloat(o.cap, 'f', -1, 64)
+	}
+	return []any{delta, o.ttl.Milliseconds(), floor, cap, kind}
+}
+
+// CounterScript 带有首次有效期以及上下限的计数器
+// KEYS[1]: 计数器
+// ARGV[1]: 增量, ARGV[2]: 首次创建时的有效期毫秒数, ARGV[3]: 下限(为空表示没有), ARGV[4]: 上限(为空表示没有), ARGV[5]: int 或者 float
+// 返回 {1, 增减后的值} 或者超出范围时返回 {0, 当前值}
+// INCRBY 的整数结果直接返回,tostring 会将大于等于1e14的整数格式化为科学计数法
+const CounterScript = `
+	local current = redis.call('GET', KEYS[1])
+	local value = tonumber(current or '0')
+	if value == nil then
+		return redis.error_reply('ERR value is not a valid number')
+	end
+	local next = value + tonumber(ARGV[1])
+	if (ARGV[3] ~= '' and next < tonumber(ARGV[3])) or (ARGV[4] ~= '' and next > tonumber(ARGV[4])) then
+		return {0, current or '0'}
+	end
+	local result
+	if ARGV[5] == 'float' then
+		result = redis.call('INCRBYFLOAT', KEYS[1], ARGV[1])
+	else
+		result = redis.call('INCRBY', KEYS[1], ARGV[1])
+	end
+	if not current and tonumber(ARGV[2]) > 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return {1, result}
+`
+
+var counterScript = NewScript("sugar_counter", CounterScript)
+
+// 执行计数器脚本,返回增减后的值或者超出范围时的当前值
+func (template *RedisTemplate) evalCounter(key, delta, kind string, o counterOptions) (string, error) {
+	values, err := template.EvalScript(template.context(), counterScript, []string{key}, o.args(delta, kind)...).Slice()
+	if err != nil {
+		return "", err
+	}
+	if len(values) != 2 {
+		return "", fmt.Errorf("unexpected counter script result %v", values)
+	}
+	var value string
+	switch v := values[1].(type) {
+	case int64:
+		value = strconv.FormatInt(v, 10)
+	case string:
+		value = v
+	default:
+		return "", fmt.Errorf("unexpected counter script result %v", values)
+	}
+	if ok, _ := values[0].(int64); ok != 1 {
+		return value, CounterOutOfRangeErr
+	}
+	return value, nil
+}
+
+// Incr 将计数器加1,返回加1后的值
+func (template *RedisTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	return template.IncrBy(key, 1, opts...)
+}
+
+// Decr 将计数器减1,返回减1后的值
+func (template *RedisTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	return template.IncrBy(key, -1, opts...)
+}
+
+// IncrBy 将计数器增加delta,返回增加后的值;计数器不存在时视为0
+// 超出上下限时返回当前值以及 CounterOutOfRangeErr
+func (template *RedisTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	o := newCounterOptions(opts)
+	if !o.scripted() {
+		return template.Client.IncrBy(template.context(), key, delta).Result()
+	}
+	value, err := template.evalCounter(key, strconv.FormatInt(delta, 10), "int", o)
+	if err != nil && !errors.Is(err, CounterOutOfRangeErr) {
+		return 0, err
+	}
+	n, parseErr := strconv.ParseInt(value, 10, 64)
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	return n, err
+}
+
+// IncrByFloat 将计数器增加浮点数delta,返回增加后的值;计数器不存在时视为0
+// 超出上下限时返回当前值以及 CounterOutOfRangeErr
+func (template *RedisTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	o := newCounterOptions(opts)
+	if !o.scripted() {
+		return template.Client.IncrByFloat(template.context(), key, delta).Result()
+	}
+	value, err := template.evalCounter(key, strconv.FormatFloat(delta, 'f', -1, 64), "float", o)
+	if err != nil && !errors.Is(err, CounterOutOfRangeErr) {
+		return 0, err
+	}
+	f, parseErr := strconv.ParseFloat(value, 64)
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	return f, err
+}
@@ -0,0 +1,186 @@
+/**
+  @author: Zero
+  @date: 2023/7/25 10:20:33
+  @desc: 有效期随机化,防止大量缓存同时过期造成缓存雪崩
+
+**/
+
+package caches
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// TTLJitter 有效期随机化策略,返回随机化后的有效期
+type TTLJitter func(ttl time.Duration) time.Duration
+
+// NoJitter 不做随机化,通常用于 ContextWithJitter 为单次调用关闭随机化
+func NoJitter(ttl time.Duration) time.Duration {
+	return ttl
+}
+
+// JitterPercent 有效期在 ±percent 的比例内随机浮动,例如0.1表示在 [0.9*ttl, 1.1*ttl] 内随机
+func JitterPercent(percent float64) TTLJitter {
+	return func(ttl time.Duration) time.Duration {
+		delta := float64(ttl) * percent
+		return positive(ttl, ttl+time.Duration((rand.Float64()*2-1)*delta))
+	}
+}
+
+// JitterRange 有效期加上 [min, max] 内的一个随机时长,min可以为负数
+func JitterRange(min, max time.Duration) TTLJitter {
+	if min > max {
+		min, max = max, min
+	}
+	return func(ttl time.Duration) time.Duration {
+		return positive(ttl, ttl+min+time.Duration(rand.Int63n(int64(max-min)+1)))
+	}
+}
+
+// 随机化后的有效期必须为正数,否则使用原有效期
+func positive(ttl, jittered time.Duration) time.Duration {
+	if jittered <= 0 {
+		return ttl
+	}
+	return jittered
+}
+
+type jitterCtxKey struct{}
+
+// ContextWithJitter 为单次调用指定随机化策略,覆盖 JitterTemplate 的默认策略
+// 例如 template.WithContext(caches.ContextWithJitter(ctx, caches.NoJitter)).SetExpire(...)
+func ContextWithJitter(ctx context.Context, jitter TTLJitter) context.Context {
+	return context.WithValue(ctx, jitterCtxKey{}, jitter)
+}
+
+// JitterTemplate 为任意缓存模板的有效期做随机化的装饰器
+// 作用于 SetExpire、MSet 中的每个缓存、ExpireAdd 以及计数器首次创建时的有效期;
+// 永不过期(0)、保留原有效期(redis.KeepTTL)以及 ExpireSetup 指定的时间点不做随机化
+type JitterTemplate struct {
+	// 被装饰的缓存模板
+	template CacheTemplate
+	// 默认的随机化策略
+	jitter TTLJitter
+	// 调用方上下文,可以通过 ContextWithJitter 携带单次调用的随机化策略
+	ctx context.Context
+}
+
+// NewJitterTemplate 使用随机化策略装饰一个缓存模板
+func NewJitterTemplate(template CacheTemplate, jitter TTLJitter) *JitterTemplate {
+	return &JitterTemplate{
+		template: template,
+		jitter:   jitter,
+		ctx:      defaultCtx,
+	}
+}
+
+// WithContext 返回一个绑定了ctx的模板副本,被装饰的模板同样会绑定ctx
+func (j *JitterTemplate) WithContext(ctx context.Context) CacheTemplate {
+	return &JitterTemplate{
+		template: BindContext(j.template, ctx),
+		jitter:   j.jitter,
+		ctx:      ctx,
+	}
+}
+
+// 随机化一个有效期
+func (j *JitterTemplate) apply(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	jitter := j.jitter
+	if override, ok := j.ctx.Value(jitterCtxKey{}).(TTLJitter); ok {
+		jitter = override
+	}
+	if jitter == nil {
+		return ttl
+	}
+	return jitter(ttl)
+}
+
+// Set 设置一个缓存
+func (j *JitterTemplate) Set(key string, value any) error {
+	return j.template.Set(key, value)
+}
+
+// SetExpire 设置一个带有有效期的缓存,有效期随机化
+func (j *JitterTemplate) SetExpire(key string, value any, expire time.Duration) error {
+	return j.template.SetExpire(key, value, j.apply(expire))
+}
+
+// MSet 批量设置缓存,每个缓存的有效期各自随机化
+func (j *JitterTemplate) MSet(items ...Item) error {
+	jittered := make([]Item, len(items))
+	for i, item := range items {
+		item.Expire = j.apply(item.Expire)
+		jittered[i] = item
+	}
+	return j.template.MSet(jittered...)
+}
+
+// Get 获取一个缓存
+func (j *JitterTemplate) Get(key string) *Reply {
+	return j.template.Get(key)
+}
+
+// Del 删除一个或者多个缓存
+func (j *JitterTemplate) Del(keys ...string) error {
+	return j.template.Del(keys...)
+}
+
+// Exists 检查一个缓存是否存在
+func (j *JitterTemplate) Exists(key string) bool {
+	return j.template.Exists(key)
+}
+
+// Keys 匹配所有符合规则的Key
+func (j *JitterTemplate) Keys(pattern string) []string {
+	return j.template.Keys(pattern)
+}
+
+// ExpireAdd 延长有效期,有效期随机化
+func (j *JitterTemplate) ExpireAdd(key string, expire time.Duration) bool {
+	return j.template.ExpireAdd(key, j.apply(expire))
+}
+
+// ExpireSetup 设置有效期为指定时间,不做随机化
+func (j *JitterTemplate) ExpireSetup(key string, at time.Time) bool {
+	return j.template.ExpireSetup(key, at)
+}
+
+// GetExpire 获取一个Key的剩余有效期
+func (j *JitterTemplate) GetExpire(key string) (time.Duration, error) {
+	return j.template.GetExpire(key)
+}
+
+// 计数器首次创建时的有效期随机化
+func (j *JitterTemplate) counterOptions(opts []CounterOption) []CounterOption {
+	return append(opts[:len(opts):len(opts)], func(options *counterOptions) {
+		options.ttl = j.apply(options.ttl)
+	})
+}
+
+// Incr 将计数器加1
+func (j *JitterTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	return j.template.Incr(key, j.counterOptions(opts)...)
+}
+
+// IncrBy 将计数器增加delta
+func (j *JitterTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	return j.template.IncrBy(key, delta, j.counterOptions(opts)...)
+}
+
+// IncrByFloat 将计数器增加浮点数delta
+func (j *JitterTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	return j.template.IncrByFloat(key, delta, j.counterOptions(opts)...)
+}
+
+// Decr 将计数器减1
+func (j *JitterTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	return j.template.Decr(key, j.counterOptions(opts)...)
+}
+
+// 确保实现了 ContextTemplate
+var _ ContextTemplate = (*JitterTemplate)(nil)
@@ -0,0 +1,98 @@
+/**
+  @author: Zero
+  @date: 2023/7/25 11:46:08
+  @desc: 有效期随机化单元测试
+
+**/
+
+package caches
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+)
+
+// 测试随机化后的有效期在配置的范围之内
+func TestJitter(t *testing.T) {
+	is := assert.New(t)
+	percent := JitterPercent(0.1)
+	span := JitterRange(-time.Second, time.Second*2)
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		ttl := percent(time.Minute)
+		is.GreaterOrEqual(ttl, time.Second*54)
+		is.LessOrEqual(ttl, time.Second*66)
+		seen[ttl] = true
+
+		ttl = span(time.Minute)
+		is.GreaterOrEqual(ttl, time.Second*59)
+		is.LessOrEqual(ttl, time.Second*62)
+	}
+	is.Greater(len(seen), 100)
+	// 随机化后不大于0时使用原有效期
+	is.Equal(time.Second, JitterRange(-time.Hour, -time.Hour)(time.Second))
+	for i := 0; i < 100; i++ {
+		is.Greater(JitterPercent(3)(time.Second), time.Duration(0))
+	}
+}
+
+// 测试装饰器对 SetExpire、MSet、ExpireAdd 以及计数器的有效期做随机化
+func TestJitterTemplate(t *testing.T) {
+	is := assert.New(t)
+	fake := clock.NewFake(time.Now())
+	memory := NewMemoryTemplate()
+	memory.Clock = fake
+	// 固定增加10秒,便于断言
+	template := NewJitterTemplate(memory, JitterRange(time.Second*10, time.Second*10))
+	ttl := func(key string) time.Duration {
+		ttl, err := memory.GetExpire(key)
+		is.NoError(err)
+		return ttl
+	}
+
+	is.NoError(template.SetExpire("jitter:set", 1, time.Minute))
+	is.Equal(time.Second*70, ttl("jitter:set"))
+	is.NoError(template.MSet(Item{Key: "jitter:m1", Value: 1, Expire: time.Minute}, Item{Key: "jitter:m2", Value: 2}))
+	is.Equal(time.Second*70, ttl("jitter:m1"))
+	is.Equal(time.Duration(-1), ttl("jitter:m2"))
+	is.True(template.ExpireAdd("jitter:set", time.Minute*2))
+	is.Equal(time.Second*130, ttl("jitter:set"))
+	_, err := template.Incr("jitter:count", WithCounterTTL(time.Minute))
+	is.NoError(err)
+	is.Equal(time.Second*70, ttl("jitter:count"))
+	is.NoError(template.Set("jitter:forever", 1))
+	is.Equal(time.Duration(-1), ttl("jitter:forever"))
+
+	// 单次调用覆盖默认策略
+	ctx := ContextWithJitter(context.Background(), NoJitter)
+	is.NoError(template.WithContext(ctx).SetExpire("jitter:exact", 1, time.Minute))
+	is.Equal(time.Minute, ttl("jitter:exact"))
+	ctx = ContextWithJitter(context.Background(), JitterRange(time.Second, time.Second))
+	is.True(template.WithContext(ctx).ExpireAdd("jitter:exact", time.Minute))
+	is.Equal(time.Second*61, ttl("jitter:exact"))
+}
+
+// 测试批量写入的缓存不会同时过期
+func TestJitterTemplate_Spread(t *testing.T) {
+	is := assert.New(t)
+	memory := NewMemoryTemplate()
+	template := NewJitterTemplate(memory, JitterPercent(0.2))
+	items := make([]Item, 100)
+	for i := range items {
+		items[i] = Item{Key: fmt.Sprintf("spread:%d", i), Value: i, Expire: time.Hour}
+	}
+	is.NoError(template.MSet(items...))
+	ttls := map[time.Duration]bool{}
+	for _, item := range items {
+		ttl, err := memory.GetExpire(item.Key)
+		is.NoError(err)
+		is.InDelta(time.Hour, ttl, float64(time.Minute*12+time.Second))
+		ttls[ttl] = true
+	}
+	is.Greater(len(ttls), 50)
+}
@@ -0,0 +1,354 @@
+/**
+  @author: Zero
+  @date: 2023/7/15 14:22:31
+  @desc: 基于进程内存的缓存模板实现
+
+**/
+
+package caches
+
+import (
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/clock"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryTemplate 进程内的缓存模板,语义与 RedisTemplate 保持一致
+// 适用于单元测试以及单实例部署,有效期通过 Clock 计算,测试时可以注入 clock.Fake
+type MemoryTemplate struct {
+	// 时钟,为nil时使用系统时钟
+	Clock clock.Clock
+	mu    sync.RWMutex
+	// 所有缓存,过期的缓存在下次访问时清理
+	items map[string]*memoryItem
+}
+
+// 一个缓存项
+type memoryItem struct {
+	// 与Redis一致,以字符串形式保存
+	value string
+	// 过期时间,零值表示永不过期
+	expireAt time.Time
+}
+
+// NewMemoryTemplate 创建一个进程内的缓存模板
+func NewMemoryTemplate() *MemoryTemplate {
+	return &MemoryTemplate{items: make(map[string]*memoryItem)}
+}
+
+// 当前时间
+func (template *MemoryTemplate) now() time.Time {
+	return clock.OrReal(template.Clock).Now()
+}
+
+// 获取未过期的缓存项,调用方需持有读锁或写锁
+func (template *MemoryTemplate) item(key string, now time.Time) (*memoryItem, bool) {
+	item, ok := template.items[key]
+	if !ok || (!item.expireAt.IsZero() && !now.Before(item.expireAt)) {
+		return nil, false
+	}
+	return item, true
+}
+
+// Set 设置一个缓存
+func (template *MemoryTemplate) Set(key string, value any) error {
+	return template.SetExpire(key, value, 0)
+}
+
+// SetExpire 设置一个带有有效时间的缓存,expire不大于0时永不过期,为 redis.KeepTTL 时保留原有效期
+func (template *MemoryTemplate) SetExpire(key string, value any, expire time.Duration) error {
+	body, err := EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	now := template.now()
+	template.items[key] = &memoryItem{value: body, expireAt: template.expireAt(key, expire, now)}
+	return nil
+}
+
+// 计算写入缓存的过期时间,零值表示永不过期;expire为 redis.KeepTTL 时保留原有效期,调用方需要持有写锁
+func (template *MemoryTemplate) expireAt(key string, expire time.Duration, now time.Time) time.Time {
+	switch {
+	case expire > 0:
+		return now.Add(expire)
+	case expire == redis.KeepTTL:
+		if old, ok := template.item(key, now); ok {
+			return old.expireAt
+		}
+	}
+	return time.Time{}
+}
+
+// MSet 批量设置缓存,所有缓存在同一次加锁中写入
+func (template *MemoryTemplate) MSet(items ...Item) error {
+	bodies := make([]string, len(items))
+	for i, item := range items {
+		body, err := EncodeValue(item.Value)
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	now := template.now()
+	for i, item := range items {
+		template.items[item.Key] = &memoryItem{value: bodies[i], expireAt: template.expireAt(item.Key, item.Expire, now)}
+	}
+	return nil
+}
+
+// Get 根据Key读取一个缓存,Key不存在时返回 redis.Nil 错误
+func (template *MemoryTemplate) Get(key string) *Reply {
+	template.mu.RLock()
+	defer template.mu.RUnlock()
+	item, ok := template.item(key, template.now())
+	if !ok {
+		return NewReply(redis.NewStringResult("", redis.Nil))
+	}
+	return NewReply(redis.NewStringResult(item.value, nil))
+}
+
+// Del 删除一个或多个缓存
+func (template *MemoryTemplate) Del(keys ...string) error {
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	for _, key := range keys {
+		delete(template.items, key)
+	}
+	return nil
+}
+
+// Exists 检查一个缓存是否存在
+func (template *MemoryTemplate) Exists(key string) bool {
+	template.mu.RLock()
+	defer template.mu.RUnlock()
+	_, ok := template.item(key, template.now())
+	return ok
+}
+
+// Keys 匹配所有符合规则的Key,规则与Redis KEYS命令一致
+func (template *MemoryTemplate) Keys(pattern string) []string {
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	now := template.now()
+	keys := []string{}
+	for key := range template.items {
+		if _, ok := template.item(key, now); !ok {
+			// 顺便清理过期的缓存
+			delete(template.items, key)
+			continue
+		}
+		if MatchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ExpireAdd 将一个缓存的有效期设置为从现在开始的time,与Redis EXPIRE命令一致
+func (template *MemoryTemplate) ExpireAdd(key string, time time.Duration) bool {
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	now := template.now()
+	item, ok := template.item(key, now)
+	if !ok {
+		return false
+	}
+	if time <= 0 {
+		delete(template.items, key)
+		return true
+	}
+	item.expireAt = now.Add(time)
+	return true
+}
+
+// ExpireSetup 设置有效期为指定时间,time早于当前时间时删除该缓存
+func (template *MemoryTemplate) ExpireSetup(key string, time time.Time) bool {
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	now := template.now()
+	item, ok := template.item(key, now)
+	if !ok {
+		return false
+	}
+	if !time.After(now) {
+		delete(template.items, key)
+		return true
+	}
+	item.expireAt = time
+	return true
+}
+
+// GetExpire 获取一个Key的剩余有效期,精度为秒
+// 与Redis一致,Key不存在时返回-2,永不过期时返回-1
+func (template *MemoryTemplate) GetExpire(key string) (time.Duration, error) {
+	template.mu.RLock()
+	defer template.mu.RUnlock()
+	now := template.now()
+	item, ok := template.item(key, now)
+	if !ok {
+		return -2, nil
+	}
+	if item.expireAt.IsZero() {
+		return -1, nil
+	}
+	return item.expireAt.Sub(now).Round(time.Second), nil
+}
+
+// 非数字的值参与计数时的错误,与Redis一致
+var (
+	notIntegerErr = errors.New("ERR value is not an integer or out of range")
+	notFloatErr   = errors.New("ERR value is not a valid float")
+)
+
+// Incr 将计数器加1,返回加1后的值
+func (template *MemoryTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	return template.IncrBy(key, 1, opts...)
+}
+
+// Decr 将计数器减1,返回减1后的值
+func (template *MemoryTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	return template.IncrBy(key, -1, opts...)
+}
+
+// IncrBy 将计数器增加delta,返回增加后的值;计数器不存在时视为0
+// 超出上下限时返回当前值以及 CounterOutOfRangeErr
+func (template *MemoryTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	o := newCounterOptions(opts)
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	item := template.counter(key, o)
+	value, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, notIntegerErr
+	}
+	next := value + delta
+	if (delta > 0 && next < value) || (delta < 0 && next > value) {
+		return 0, notIntegerErr
+	}
+	if !o.inRange(float64(next)) {
+		return value, CounterOutOfRangeErr
+	}
+	item.value = strconv.FormatInt(next, 10)
+	template.items[key] = item
+	return next, nil
+}
+
+// IncrByFloat 将计数器增加浮点数delta,返回增加后的值;计数器不存在时视为0
+// 超出上下限时返回当前值以及 CounterOutOfRangeErr
+func (template *MemoryTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	o := newCounterOptions(opts)
+	template.mu.Lock()
+	defer template.mu.Unlock()
+	item := template.counter(key, o)
+	value, err := strconv.ParseFloat(item.value, 64)
+	if err != nil {
+		return 0, notFloatErr
+	}
+	next := value + delta
+	if math.IsInf(next, 0) || math.IsNaN(next) {
+		return 0, notFloatErr
+	}
+	if !o.inRange(next) {
+		return value, CounterOutOfRangeErr
+	}
+	item.value = strconv.FormatFloat(next, 'f', -1, 64)
+	template.items[key] = item
+	return next, nil
+}
+
+// 获取计数器,不存在时返回值为0的新缓存项,有效期在首次创建时设置
+// 新缓存项只有在调用方写回 items 后才生效,调用方需持有写锁
+func (template *MemoryTemplate) counter(key string, o counterOptions) *memoryItem {
+	now := template.now()
+	if item, ok := template.item(key, now); ok {
+		return item
+	}
+	item := &memoryItem{value: "0"}
+	if o.ttl > 0 {
+		item.expireAt = now.Add(o.ttl)
+	}
+	return item
+}
+
+// MatchPattern 判断key是否匹配Redis风格的通配符规则
+// 支持 `*`、`?`、`[abc]`、`[^abc]`、`[a-z]` 以及 `\` 转义
+func MatchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// 合并连续的`*`
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if MatchPattern(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			key = key[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			end := 1
+			negate := end < len(pattern) && pattern[end] == '^'
+			if negate {
+				end++
+			}
+			matched := false
+			for ; end < len(pattern) && pattern[end] != ']'; end++ {
+				c := pattern[end]
+				if c == '\\' && end+1 < len(pattern) {
+					end++
+					matched = matched || pattern[end] == key[0]
+				} else if end+2 < len(pattern) && pattern[end+1] == '-' && pattern[end+2] != ']' {
+					lo, hi := c, pattern[end+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (key[0] >= lo && key[0] <= hi)
+					end += 2
+				} else {
+					matched = matched || c == key[0]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			key = key[1:]
+			if end < len(pattern) {
+				pattern = pattern[end:]
+			} else {
+				pattern = pattern[len(pattern)-1:]
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+			key = key[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(key) == 0
+}
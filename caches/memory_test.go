@@ -0,0 +1,119 @@
+/**
+  @author: Zero
+  @date: 2023/7/15 15:10:42
+  @desc: 进程内缓存模板单元测试
+
+**/
+
+package caches
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+)
+
+// 测试通过手动时钟控制缓存的有效期
+func TestMemoryTemplate_Expire(t *testing.T) {
+	is := assert.New(t)
+	fake := clock.NewFake(time.Now())
+	template := NewMemoryTemplate()
+	template.Clock = fake
+
+	is.NoError(template.SetExpire("memory:user", Student{Name: "zero", Age: 18}, time.Second*10))
+	is.NoError(template.Set("memory:forever", 1))
+	ttl, err := template.GetExpire("memory:user")
+	is.NoError(err)
+	is.Equal(time.Second*10, ttl)
+	ttl, _ = template.GetExpire("memory:forever")
+	is.Equal(time.Duration(-1), ttl)
+
+	var student Student
+	is.NoError(template.Get("memory:user").ToAny(&student))
+	is.Equal("zero", student.Name)
+
+	fake.Advance(time.Second * 9)
+	is.True(template.ExpireAdd("memory:user", time.Second*5))
+	fake.Advance(time.Second * 4)
+	is.True(template.Exists("memory:user"))
+	fake.Advance(time.Second)
+	is.False(template.Exists("memory:user"))
+	is.ErrorIs(template.Get("memory:user").Err(), redis.Nil)
+	ttl, _ = template.GetExpire("memory:user")
+	is.Equal(time.Duration(-2), ttl)
+
+	is.True(template.ExpireSetup("memory:forever", fake.Now().Add(time.Minute)))
+	fake.Advance(time.Minute)
+	is.False(template.Exists("memory:forever"))
+	is.Empty(template.Keys("*"))
+}
+
+// 测试缓存值的编码与写入Redis的内容一致,nil编码为空字符串
+func TestEncodeValue(t *testing.T) {
+	is := assert.New(t)
+	for _, c := range []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{"v", "v"},
+		{[]byte("b"), "b"},
+		{true, "1"},
+		{42, "42"},
+		{1.5, "1.5"},
+		{time.Second, "1000000000"},
+		{time.Date(2023, 7, 15, 14, 22, 31, 0, time.UTC), `"2023-07-15T14:22:31Z"`},
+		{Student{Name: "zero"}, `{"Name":"zero","Sex":false,"Age":0}`},
+	} {
+		body, err := EncodeValue(c.value)
+		is.NoError(err)
+		is.Equal(c.want, body)
+	}
+	// 与go-redis一致,无法编码的类型返回错误
+	type level int
+	_, err := EncodeValue(level(1))
+	is.Error(err)
+	is.NoError(NewMemoryTemplate().Set("memory:nil", nil))
+}
+
+// 测试Redis风格的通配符规则
+func TestMatchPattern(t *testing.T) {
+	is := assert.New(t)
+	is.True(MatchPattern("*", "user:1"))
+	is.True(MatchPattern("user:*", "user:1"))
+	is.False(MatchPattern("user:*", "order:1"))
+	is.True(MatchPattern("h?llo", "hello"))
+	is.True(MatchPattern("h[ae]llo", "hallo"))
+	is.False(MatchPattern("h[^e]llo", "hello"))
+	is.True(MatchPattern("h[a-b]llo", "hbllo"))
+	is.True(MatchPattern(`user\*`, "user*"))
+	is.False(MatchPattern(`user\*`, "user1"))
+	is.True(MatchPattern("a*b*c", "axxbyyc"))
+}
+
+// 测试并发扣减有下限的计数器,成功的次数恰好等于初始值
+func TestMemoryTemplate_CounterConcurrent(t *testing.T) {
+	is := assert.New(t)
+	template := NewMemoryTemplate()
+	is.NoError(template.Set("memory:stock", 50))
+
+	var succeeded atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := template.Decr("memory:stock", WithFloor(0)); err == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(int32(50), succeeded.Load())
+	is.Equal("0", template.Get("memory:stock").GetString())
+}
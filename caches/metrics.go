@@ -0,0 +1,185 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 16:05:20
+  @desc: 带有指标采集的缓存模板装饰器
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/metrics"
+	"time"
+)
+
+// MetricsTemplate 为任意缓存模板采集命中率、错误以及耗时指标
+type MetricsTemplate struct {
+	// 被装饰的缓存模板
+	template CacheTemplate
+	// 指标采集器
+	recorder metrics.Recorder
+}
+
+// NewMetricsTemplate 使用指标采集器装饰一个缓存模板
+func NewMetricsTemplate(template CacheTemplate, recorder metrics.Recorder) *MetricsTemplate {
+	return &MetricsTemplate{
+		template: template,
+		recorder: metrics.OrNop(recorder),
+	}
+}
+
+// WithContext 返回一个绑定了ctx的模板副本,被装饰的模板同样会绑定ctx
+func (m *MetricsTemplate) WithContext(ctx context.Context) CacheTemplate {
+	return &MetricsTemplate{
+		template: BindContext(m.template, ctx),
+		recorder: m.recorder,
+	}
+}
+
+// 记录一次操作
+func (m *MetricsTemplate) observe(op, result string, start time.Time) {
+	m.recorder.ObserveCache(op, result, time.Since(start))
+}
+
+// 根据error获取操作结果
+func errResult(err error) string {
+	if err != nil {
+		return metrics.CacheError
+	}
+	return metrics.CacheOk
+}
+
+// 根据bool获取操作结果
+func boolResult(ok bool) string {
+	if ok {
+		return metrics.CacheHit
+	}
+	return metrics.CacheMiss
+}
+
+// Set 设置一个缓存
+func (m *MetricsTemplate) Set(key string, value any) error {
+	start := time.Now()
+	err := m.template.Set(key, value)
+	m.observe("Set", errResult(err), start)
+	return err
+}
+
+// SetExpire 设置一个带有有效期的缓存
+func (m *MetricsTemplate) SetExpire(key string, value any, expire time.Duration) error {
+	start := time.Now()
+	err := m.template.SetExpire(key, value, expire)
+	m.observe("SetExpire", errResult(err), start)
+	return err
+}
+
+// Get 获取一个缓存
+func (m *MetricsTemplate) Get(key string) *Reply {
+	start := time.Now()
+	reply := m.template.Get(key)
+	switch err := reply.Err(); {
+	case reply.tombstone():
+		m.observe("Get", metrics.CacheAbsent, start)
+	case err == nil:
+		m.observe("Get", metrics.CacheHit, start)
+	case errors.Is(err, redis.Nil):
+		m.observe("Get", metrics.CacheMiss, start)
+	default:
+		m.observe("Get", metrics.CacheError, start)
+	}
+	return reply
+}
+
+// Del 删除一个或者多个缓存
+func (m *MetricsTemplate) Del(keys ...string) error {
+	start := time.Now()
+	err := m.template.Del(keys...)
+	m.observe("Del", errResult(err), start)
+	return err
+}
+
+// Exists 检查一个缓存是否存在
+func (m *MetricsTemplate) Exists(key string) bool {
+	start := time.Now()
+	ok := m.template.Exists(key)
+	m.observe("Exists", boolResult(ok), start)
+	return ok
+}
+
+// Keys 匹配所有符合规则的Key
+func (m *MetricsTemplate) Keys(pattern string) []string {
+	start := time.Now()
+	keys := m.template.Keys(pattern)
+	m.observe("Keys", metrics.CacheOk, start)
+	return keys
+}
+
+// ExpireAdd 延长有效期
+func (m *MetricsTemplate) ExpireAdd(key string, expire time.Duration) bool {
+	start := time.Now()
+	ok := m.template.ExpireAdd(key, expire)
+	m.observe("ExpireAdd", boolResult(ok), start)
+	return ok
+}
+
+// ExpireSetup 设置有效期为指定时间
+func (m *MetricsTemplate) ExpireSetup(key string, at time.Time) bool {
+	start := time.Now()
+	ok := m.template.ExpireSetup(key, at)
+	m.observe("ExpireSetup", boolResult(ok), start)
+	return ok
+}
+
+// GetExpire 获取一个Key的剩余有效期
+func (m *MetricsTemplate) GetExpire(key string) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := m.template.GetExpire(key)
+	m.observe("GetExpire", errResult(err), start)
+	return ttl, err
+}
+
+// MSet 批量设置缓存
+func (m *MetricsTemplate) MSet(items ...Item) error {
+	start := time.Now()
+	err := m.template.MSet(items...)
+	m.observe("MSet", errResult(err), start)
+	return err
+}
+
+// Incr 将计数器加1
+func (m *MetricsTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	start := time.Now()
+	n, err := m.template.Incr(key, opts...)
+	m.observe("Incr", errResult(err), start)
+	return n, err
+}
+
+// IncrBy 将计数器增加delta
+func (m *MetricsTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	start := time.Now()
+	n, err := m.template.IncrBy(key, delta, opts...)
+	m.observe("IncrBy", errResult(err), start)
+	return n, err
+}
+
+// IncrByFloat 将计数器增加浮点数delta
+func (m *MetricsTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	start := time.Now()
+	f, err := m.template.IncrByFloat(key, delta, opts...)
+	m.observe("IncrByFloat", errResult(err), start)
+	return f, err
+}
+
+// Decr 将计数器减1
+func (m *MetricsTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	start := time.Now()
+	n, err := m.template.Decr(key, opts...)
+	m.observe("Decr", errResult(err), start)
+	return n, err
+}
+
+// 确保实现了 ContextTemplate
+var _ ContextTemplate = (*MetricsTemplate)(nil)
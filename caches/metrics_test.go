@@ -0,0 +1,56 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 17:12:40
+  @desc: 缓存指标采集单元测试
+
+**/
+
+package caches
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录所有缓存操作结果的采集器
+type recordingRecorder struct {
+	mu      sync.Mutex
+	results []string
+}
+
+func (r *recordingRecorder) ObserveCache(op, result string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, op+":"+result)
+}
+func (r *recordingRecorder) ObserveLockAcquire(string, int, time.Duration) {}
+func (r *recordingRecorder) ObserveLockRenewal(string)                    {}
+
+// 测试缓存命中、未命中指标
+func TestMetricsTemplate(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	redisTemplate := newFakeTemplate(t)
+	recorder := &recordingRecorder{}
+	template := NewMetricsTemplate(&redisTemplate, recorder)
+
+	is.NoError(template.SetExpire("metrics-k1", "v1", time.Second*10))
+	is.True(template.Get("metrics-k1").Ok())
+	is.False(template.Get("metrics-k2").Ok())
+	is.False(template.Exists("metrics-k2"))
+	is.Equal([]string{"SetExpire:ok", "Get:hit", "Get:miss", "Exists:miss"}, recorder.results)
+}
+
+// 测试读取墓碑记录为确定不存在
+func TestMetricsTemplate_Absent(t *testing.T) {
+	is := assert.New(t)
+	recorder := &recordingRecorder{}
+	template := NewMetricsTemplate(NewMemoryTemplate(), recorder)
+
+	is.NoError(template.SetExpire("metrics-absent", Tombstone, time.Second*10))
+	is.Equal(Tombstone, template.Get("metrics-absent").GetString())
+	is.Equal([]string{"SetExpire:ok", "Get:absent"}, recorder.results)
+}
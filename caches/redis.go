@@ -9,11 +9,15 @@ package caches
 
 import (
 	"context"
+	"encoding"
 	"errors"
+	"fmt"
 	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/logs"
 	"github.com/zlx2019/toys/converts"
-	"log"
 	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -23,6 +27,15 @@ var defaultCtx = context.Background()
 // RedisTemplate Redis缓存组件模板实现
 type RedisTemplate struct {
 	Client *redis.Client
+	// 日志组件,为nil时不输出日志
+	Logger logs.Logger
+	// Lua脚本注册表,为nil时使用默认的注册表
+	Scripts *ScriptRegistry
+	// 时钟,为nil时由Redis服务端的时钟计算 ExpireSetup 的到期时刻
+	// 设置后按该时钟将到期时刻换算为剩余有效期,测试时可以与进程内的Redis替身共用 clock.Fake
+	Clock clock.Clock
+	// 调用方上下文,通过 WithContext 绑定,为nil时使用默认上下文
+	ctx context.Context
 }
 
 // NewDefaultRedisTemplate 创建一个默认Redis客户端
@@ -33,9 +46,26 @@ func NewDefaultRedisTemplate() RedisTemplate {
 			Password: "root1234",
 			DB:       0,
 		}),
+		Scripts: NewScriptRegistry(),
 	}
 }
 
+// WithContext 返回一个绑定了调用方上下文的模板副本
+// 副本的所有缓存操作都将使用该上下文,用于超时控制以及链路追踪的传播
+func (template *RedisTemplate) WithContext(ctx context.Context) CacheTemplate {
+	clone := *template
+	clone.ctx = ctx
+	return &clone
+}
+
+// 获取缓存操作使用的上下文
+func (template *RedisTemplate) context() context.Context {
+	if template.ctx == nil {
+		return defaultCtx
+	}
+	return template.ctx
+}
+
 // Set 设置一个缓存
 func (template *RedisTemplate) Set(key string, value any) error {
 	return template.SetExpire(key, value, 0)
@@ -43,30 +73,99 @@ func (template *RedisTemplate) Set(key string, value any) error {
 
 // SetExpire 设置一个带有有效时间的缓存
 func (template *RedisTemplate) SetExpire(key string, value any, expire time.Duration) error {
-	var body any
-	var err error
+	body, err := EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	status := template.Client.Set(template.context(), key, body, expire)
+	if status.Err() != nil {
+		return status.Err()
+	}
+	return nil
+}
+
+// EncodeValue 将缓存值编码为字符串,RedisTemplate 与 MemoryTemplate 都通过该函数序列化缓存值
+// Struct、Slice、Map等复杂结构序列化为Json,其余类型按go-redis的命令参数规则编码
+func EncodeValue(value any) (string, error) {
+	if value == nil {
+		// 与go-redis的参数编码一致
+		return "", nil
+	}
 	// 通过反射断言类型
 	switch reflect.TypeOf(value).Kind() {
 	// Struct、Slice、Map等复杂结构自定义序列化为[]byte,避免没有实现BinaryMarshaler()而发生错误
 	// 后续有更好的方案再度优化
 	case reflect.Struct, reflect.Slice, reflect.Map:
-		body, err = converts.ToBytes(value)
+		body, err := converts.ToBytes(value)
+		return string(body), err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		body, err := v.MarshalBinary()
+		return string(body), err
 	default:
-		body = value
+		return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
 	}
-	if err != nil {
-		return err
+}
+
+// MSet 批量设置缓存,所有SET命令在一个事务中执行
+func (template *RedisTemplate) MSet(items ...Item) error {
+	if len(items) == 0 {
+		return nil
 	}
-	status := template.Client.Set(defaultCtx, key, body, expire)
-	if status.Err() != nil {
-		return status.Err()
+	bodies := make([]string, len(items))
+	for i, item := range items {
+		body, err := EncodeValue(item.Value)
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
 	}
-	return nil
+	_, err := template.Client.TxPipelined(template.context(), func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			pipe.Set(template.context(), item.Key, bodies[i], item.Expire)
+		}
+		return nil
+	})
+	return err
 }
 
 // Get 根据Key读取一个缓存
 func (template *RedisTemplate) Get(key string) *Reply {
-	cmd := template.Client.Get(defaultCtx, key)
+	cmd := template.Client.Get(template.context(), key)
 	//TODO  Nil表示Key不存在,严格来说并不是一种错误,暂不处理
 	//if err := cmd.Err(); err != nil && err == redis.Nil {
 	//
@@ -76,15 +175,15 @@ func (template *RedisTemplate) Get(key string) *Reply {
 
 // Del 删除一个或多个缓存
 func (template *RedisTemplate) Del(keys ...string) error {
-	return template.Client.Del(defaultCtx, keys...).Err()
+	return template.Client.Del(template.context(), keys...).Err()
 }
 
 // Exists 检查一个缓存是否存在
 func (template *RedisTemplate) Exists(key string) bool {
 	// 当n为1时表示存在,表示不存在。
-	n, err := template.Client.Exists(defaultCtx, key).Result()
+	n, err := template.Client.Exists(template.context(), key).Result()
 	if err != nil {
-		log.Printf("exists command error %s", err)
+		logs.OrNop(template.Logger).Error("redis exists command failed", "key", key, "error", err)
 		return false
 	}
 	if n < 1 {
@@ -95,7 +194,7 @@ func (template *RedisTemplate) Exists(key string) bool {
 
 // Keys 匹配所有符合规则的Key
 func (template *RedisTemplate) Keys(pattern string) []string {
-	keys, err := template.Client.Keys(defaultCtx, pattern).Result()
+	keys, err := template.Client.Keys(template.context(), pattern).Result()
 	if err != nil {
 		return []string{}
 	}
@@ -104,7 +203,7 @@ func (template *RedisTemplate) Keys(pattern string) []string {
 
 // ExpireAdd 延长一个缓存的有效期
 func (template *RedisTemplate) ExpireAdd(key string, time time.Duration) bool {
-	ok, err := template.Client.Expire(defaultCtx, key, time).Result()
+	ok, err := template.Client.Expire(template.context(), key, time).Result()
 	if err != nil {
 		return false
 	}
@@ -113,7 +212,13 @@ func (template *RedisTemplate) ExpireAdd(key string, time time.Duration) bool {
 
 // ExpireSetup 设置有效期为指定时间
 func (template *RedisTemplate) ExpireSetup(key string, time time.Time) bool {
-	ok, err := template.Client.ExpireAt(defaultCtx, key, time).Result()
+	var cmd *redis.BoolCmd
+	if template.Clock != nil {
+		cmd = template.Client.PExpire(template.context(), key, template.Clock.Until(time))
+	} else {
+		cmd = template.Client.ExpireAt(template.context(), key, time)
+	}
+	ok, err := cmd.Result()
 	if err != nil {
 		return false
 	}
@@ -122,7 +227,7 @@ func (template *RedisTemplate) ExpireSetup(key string, time time.Time) bool {
 
 // GetExpire 获取一个Key的剩余有效期
 func (template *RedisTemplate) GetExpire(key string) (time.Duration, error) {
-	return template.Client.TTL(defaultCtx, key).Result()
+	return template.Client.TTL(template.context(), key).Result()
 }
 
 // SetNEX 设置一个缓存,带有有效期,如果key已存在,则设置失败.
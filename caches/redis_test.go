@@ -10,18 +10,38 @@ package caches
 import (
 	"context"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
 	"github.com/zlx2019/toys/converts"
 	"testing"
 	"time"
 )
 
+// 启动一个进程内的Redis替身,返回连接到该替身的模板以及替身本身
+// caches 包内的测试引用 internal/redisfake 会造成循环依赖,因此直接使用 miniredis
+// 替身中的时间不会随真实时间推进,需要通过 FastForward 让Key过期
+func newFakeRedis(t testing.TB) (RedisTemplate, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return RedisTemplate{Client: client, Scripts: NewScriptRegistry()}, server
+}
+
+// 启动一个进程内的Redis替身,返回连接到该替身的模板
+func newFakeTemplate(t testing.TB) RedisTemplate {
+	template, _ := newFakeRedis(t)
+	return template
+}
+
 // 测试设置缓存
 func TestSet(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 	var num = 123
 	err := template.Set("testKey1", num)
 	is.NoError(err)
@@ -49,7 +69,7 @@ func TestGet(t *testing.T) {
 		Age:  18,
 	}
 	// 获取连接
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 
 	// 设置缓存
 	err := template.Set("s1", s1)
@@ -85,18 +105,18 @@ func TestGet(t *testing.T) {
 func TestSetExpire(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template, server := newFakeRedis(t)
 	// 设置有效期3秒
 	err := template.SetExpire("kk1", "vv1", time.Second*3)
 	is.NoError(err)
 
 	// 2秒后取一次
-	time.Sleep(time.Second * 2)
+	server.FastForward(time.Second * 2)
 	reply := template.Get("kk1")
 	is.NoError(reply.Err())
 
 	// 2秒后再取一次,不存在
-	time.Sleep(time.Second * 2)
+	server.FastForward(time.Second * 2)
 	reply = template.Get("kk1")
 	is.Error(reply.Err())
 	is.Equal(reply.GetValue(), "")
@@ -105,7 +125,7 @@ func TestSetExpire(t *testing.T) {
 func TestDel(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 	err := template.Del("ns1")
 	is.NoError(err)
 }
@@ -113,7 +133,7 @@ func TestDel(t *testing.T) {
 func TestExists(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 	// 已存在断言
 	is.NoError(template.Set("l1", "v1"))
 	is.True(template.Exists("l1"))
@@ -124,7 +144,7 @@ func TestExists(t *testing.T) {
 func TestExpireAdd(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template, server := newFakeRedis(t)
 	// 设置缓存
 	err := template.Set("ok1", "ok1")
 	is.NoError(err)
@@ -137,17 +157,34 @@ func TestExpireAdd(t *testing.T) {
 	is.Equal(reply.GetString(), "ok1")
 
 	// 等待缓存失效
-	time.Sleep(time.Second * 4)
+	server.FastForward(time.Second * 4)
 	// 再次获取缓存
 	reply = template.Get("ok1")
 	// redis.Nil表示Key已不存在的错误
 	is.Equal(reply.Err(), redis.Nil)
 }
 
+// 测试按模板的时钟将到期时刻换算为剩余有效期
+func TestExpireSetup_Clock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template, server := newFakeRedis(t)
+	// 模板的时钟比替身慢一小时
+	template.Clock = clock.NewFake(time.Now().Add(-time.Hour))
+	is.NoError(template.Set("es1", "es1"))
+	is.True(template.ExpireSetup("es1", template.Clock.Now().Add(time.Second*3)))
+	ttl, err := template.GetExpire("es1")
+	is.NoError(err)
+	is.Equal(time.Second*3, ttl)
+
+	server.FastForward(time.Second * 3)
+	is.False(template.Exists("es1"))
+}
+
 func TestGetExpire(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 	err := template.SetExpire("l1", true, time.Second*60)
 	is.NoError(err)
 	expire, err := template.GetExpire("l1")
@@ -158,7 +195,7 @@ func TestGetExpire(t *testing.T) {
 func TestRedisTemplate_SetNEX(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	template := NewDefaultRedisTemplate()
+	template := newFakeTemplate(t)
 	err := template.SetNEX(context.Background(), "lock1", "xxxx", time.Second*10)
 	is.NoError(err)
 
@@ -12,13 +12,17 @@ import (
 	"github.com/zlx2019/toys/converts"
 )
 
+// Tombstone 墓碑值,表示数据源中确定不存在该数据
+// 墓碑对模板而言是普通的值,只有 Aside.Get 读取到墓碑时返回 Absent() 为true、Err() 为 NotFoundErr 的 Reply
+const Tombstone = "\x00sugar:tombstone\x00"
+
 // Reply 操作响应
 type Reply struct {
 	// Redis操作响应对象
-	cmd *redis.StringCmd
-	err error //错误响应
-	ok  bool  //操作是否成功
-
+	cmd    *redis.StringCmd
+	err    error //错误响应
+	ok     bool  //操作是否成功
+	absent bool  //数据是否确定不存在
 }
 
 func NewReply(cmd *redis.StringCmd) *Reply {
@@ -39,6 +43,17 @@ func (reply *Reply) Ok() bool {
 	return reply.ok
 }
 
+// Absent 数据是否确定不存在,即 Aside.Get 读取到了墓碑、被Key过滤器拦截或者加载函数返回了 NotFoundErr
+// 与未命中(Err() 为 redis.Nil)不同,确定不存在的数据无需再访问数据源
+func (reply *Reply) Absent() bool {
+	return reply.absent
+}
+
+// 是否读取到了墓碑
+func (reply *Reply) tombstone() bool {
+	return reply.ok && reply.cmd.Val() == Tombstone
+}
+
 // GetValue  获取响应结果
 func (reply *Reply) GetValue() interface{} {
 	return reply.cmd.Val()
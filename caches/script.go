@@ -0,0 +1,272 @@
+/**
+  @author: Zero
+  @date: 2023/7/8 10:40:12
+  @desc: Lua脚本注册表,通过EVALSHA或者Redis 7 Functions调用脚本
+
+**/
+
+package caches
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"sync"
+)
+
+// ScriptNotFoundErr 调用了未注册的脚本
+var ScriptNotFoundErr = errors.New("script not found")
+
+// 未指定注册表的模板共用的默认注册表
+var defaultScripts = NewScriptRegistry()
+
+// Script 通过SHA1调用的Lua脚本,只在服务端没有缓存时才发送脚本内容
+type Script struct {
+	// 脚本名称,启用Functions时作为函数名称,只能包含字母、数字以及下划线
+	name string
+	// 脚本内容
+	src string
+	// 脚本内容的SHA1
+	hash string
+}
+
+// NewScript 创建一个脚本
+func NewScript(name, src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{
+		name: name,
+		src:  src,
+		hash: hex.EncodeToString(sum[:]),
+	}
+}
+
+// Name 脚本名称
+func (script *Script) Name() string {
+	return script.name
+}
+
+// Hash 脚本内容的SHA1
+func (script *Script) Hash() string {
+	return script.hash
+}
+
+// ScriptRegistry 脚本注册表,按名称管理脚本
+// 默认通过EVALSHA调用脚本,服务端返回NOSCRIPT(例如重启或者主从切换)时自动重新加载
+// 启用 UseFunctions 后,所有脚本作为一个函数库加载到Redis 7 Functions中,通过FCALL调用
+type ScriptRegistry struct {
+	mu sync.RWMutex
+	// 已注册的脚本
+	scripts map[string]*Script
+	// Functions函数库名称,为空表示不启用
+	library string
+	// 函数库是否已经加载了所有脚本
+	loaded bool
+	// 服务端不支持Functions,回退到EVALSHA
+	unsupported bool
+}
+
+// NewScriptRegistry 创建一个脚本注册表
+func NewScriptRegistry() *ScriptRegistry {
+	return &ScriptRegistry{scripts: make(map[string]*Script)}
+}
+
+// UseFunctions 启用Redis 7 Functions,所有脚本作为名为library的函数库加载
+// 服务端不支持Functions时自动回退到EVALSHA
+func (registry *ScriptRegistry) UseFunctions(library string) *ScriptRegistry {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.library = library
+	registry.loaded = false
+	return registry
+}
+
+// Register 注册一个脚本,同名脚本将被替换
+func (registry *ScriptRegistry) Register(name, src string) *Script {
+	script := NewScript(name, src)
+	registry.add(script)
+	return script
+}
+
+// 添加脚本,脚本内容发生变化时需要重新加载函数库
+func (registry *ScriptRegistry) add(script *Script) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if old, ok := registry.scripts[script.name]; ok && old.hash == script.hash {
+		return
+	}
+	registry.scripts[script.name] = script
+	registry.loaded = false
+}
+
+// Get 根据名称获取脚本
+func (registry *ScriptRegistry) Get(name string) (*Script, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	script, ok := registry.scripts[name]
+	return script, ok
+}
+
+// 是否使用Functions调用脚本
+func (registry *ScriptRegistry) functions() bool {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.library != "" && !registry.unsupported
+}
+
+// 将所有脚本作为函数库加载到服务端
+func (registry *ScriptRegistry) loadLibrary(ctx context.Context, client *redis.Client, force bool) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.loaded && !force {
+		return nil
+	}
+	var code strings.Builder
+	fmt.Fprintf(&code, "#!lua name=%s\n", registry.library)
+	for name, script := range registry.scripts {
+		// 以KEYS、ARGV作为函数参数,脚本内容无需修改
+		fmt.Fprintf(&code, "redis.register_function('%s', function(KEYS, ARGV)\n%s\nend)\n", name, script.src)
+	}
+	err := client.FunctionLoadReplace(ctx, code.String()).Err()
+	if isUnknownCommand(err) {
+		// 低于Redis 7的版本,回退到EVALSHA
+		registry.unsupported = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	registry.loaded = true
+	return nil
+}
+
+// 是否为服务端不支持的命令
+func isUnknownCommand(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+// 获取模板使用的脚本注册表
+func (template *RedisTemplate) scripts() *ScriptRegistry {
+	if template.Scripts == nil {
+		return defaultScripts
+	}
+	return template.Scripts
+}
+
+// RegisterScript 在模板的脚本注册表中注册一个脚本
+func (template *RedisTemplate) RegisterScript(name, src string) *Script {
+	return template.scripts().Register(name, src)
+}
+
+// EvalScript 执行一个脚本
+// 优先通过EVALSHA调用,服务端没有缓存该脚本时加载后重试;启用Functions时通过FCALL调用
+func (template *RedisTemplate) EvalScript(ctx context.Context, script *Script, keys []string, args ...any) *redis.Cmd {
+	registry := template.scripts()
+	if registry.functions() {
+		return template.fcall(ctx, registry, script, keys, args...)
+	}
+	cmd := template.Client.EvalSha(ctx, script.hash, keys, args...)
+	if !redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+		return cmd
+	}
+	// 服务端没有缓存该脚本,加载后重试
+	if err := template.Client.ScriptLoad(ctx, script.src).Err(); err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	return template.Client.EvalSha(ctx, script.hash, keys, args...)
+}
+
+// 通过Functions调用脚本
+func (template *RedisTemplate) fcall(ctx context.Context, registry *ScriptRegistry, script *Script, keys []string, args ...any) *redis.Cmd {
+	registry.add(script)
+	if err := registry.loadLibrary(ctx, template.Client, false); err != nil {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	if !registry.functions() {
+		// 服务端不支持Functions
+		return template.EvalScript(ctx, script, keys, args...)
+	}
+	cmd := template.Client.FCall(ctx, script.name, keys, args...)
+	if err := cmd.Err(); err == nil || !strings.Contains(err.Error(), "Function not found") {
+		return cmd
+	}
+	// 函数库丢失(例如主从切换),重新加载后重试
+	if err := registry.loadLibrary(ctx, template.Client, true); err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	return template.Client.FCall(ctx, script.name, keys, args...)
+}
+
+// EvalNamed 根据名称执行一个已注册的脚本,脚本未注册时返回 ScriptNotFoundErr
+func (template *RedisTemplate) EvalNamed(ctx context.Context, name string, keys []string, args ...any) *redis.Cmd {
+	script, ok := template.scripts().Get(name)
+	if !ok {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(fmt.Errorf("%w: %s", ScriptNotFoundErr, name))
+		return cmd
+	}
+	return template.EvalScript(ctx, script, keys, args...)
+}
+
+// TypedScript 返回值为T类型的脚本
+// T 支持 int64、int、float64、bool、string、[]any、[]string、[]int64,其他类型直接断言
+type TypedScript[T any] struct {
+	*Script
+}
+
+// NewTypedScript 创建一个返回值为T类型的脚本
+func NewTypedScript[T any](name, src string) TypedScript[T] {
+	return TypedScript[T]{NewScript(name, src)}
+}
+
+// RegisterTypedScript 在模板的脚本注册表中注册一个返回值为T类型的脚本
+func RegisterTypedScript[T any](template *RedisTemplate, name, src string) TypedScript[T] {
+	return TypedScript[T]{template.RegisterScript(name, src)}
+}
+
+// Run 执行脚本,并将返回值转换为T类型
+func (script TypedScript[T]) Run(ctx context.Context, template *RedisTemplate, keys []string, args ...any) (T, error) {
+	return ScriptResult[T](template.EvalScript(ctx, script.Script, keys, args...))
+}
+
+// ScriptResult 将脚本的返回值转换为T类型
+func ScriptResult[T any](cmd *redis.Cmd) (T, error) {
+	var result T
+	var val any
+	var err error
+	switch any(result).(type) {
+	case int64:
+		val, err = cmd.Int64()
+	case int:
+		val, err = cmd.Int()
+	case float64:
+		val, err = cmd.Float64()
+	case bool:
+		val, err = cmd.Bool()
+	case string:
+		val, err = cmd.Text()
+	case []string:
+		val, err = cmd.StringSlice()
+	case []int64:
+		val, err = cmd.Int64Slice()
+	case []any:
+		val, err = cmd.Slice()
+	default:
+		val, err = cmd.Result()
+	}
+	if err != nil {
+		return result, err
+	}
+	typed, ok := val.(T)
+	if !ok {
+		return result, fmt.Errorf("script result %T can't convert to %T", val, result)
+	}
+	return typed, nil
+}
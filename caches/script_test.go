@@ -0,0 +1,68 @@
+/**
+  @author: Zero
+  @date: 2023/7/8 11:20:36
+  @desc: Lua脚本注册表 单元测试
+
+**/
+
+package caches
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 测试通过EVALSHA执行脚本,脚本缓存被清空后自动重新加载
+func TestEvalScript(t *testing.T) {
+	is := assert.New(t)
+	template := newFakeTemplate(t)
+	ctx := context.Background()
+	script := template.RegisterScript("sugar_test_echo", `return ARGV[1]`)
+	val, err := template.EvalScript(ctx, script, nil, "hello").Text()
+	is.NoError(err)
+	is.Equal("hello", val)
+	exists, err := template.Client.ScriptExists(ctx, script.Hash()).Result()
+	is.NoError(err)
+	is.Equal([]bool{true}, exists)
+
+	is.NoError(template.Client.ScriptFlush(ctx).Err())
+	val, err = template.EvalScript(ctx, script, nil, "world").Text()
+	is.NoError(err)
+	is.Equal("world", val)
+}
+
+// 测试根据名称执行脚本以及类型化的返回值
+func TestEvalNamedAndTyped(t *testing.T) {
+	is := assert.New(t)
+	template := newFakeTemplate(t)
+	ctx := context.Background()
+	template.RegisterScript("sugar_test_sum", `return tonumber(ARGV[1]) + tonumber(ARGV[2])`)
+	val, err := template.EvalNamed(ctx, "sugar_test_sum", nil, 1, 2).Int64()
+	is.NoError(err)
+	is.Equal(int64(3), val)
+	_, err = template.EvalNamed(ctx, "sugar_test_missing", nil).Result()
+	is.ErrorIs(err, ScriptNotFoundErr)
+
+	keys := NewTypedScript[[]string]("sugar_test_keys", `return KEYS`)
+	list, err := keys.Run(ctx, &template, []string{"a", "b"})
+	is.NoError(err)
+	is.Equal([]string{"a", "b"}, list)
+	_, err = NewTypedScript[int64]("sugar_test_text", `return 'x'`).Run(ctx, &template, nil)
+	is.Error(err)
+}
+
+// 测试启用Functions,服务端不支持时回退到EVALSHA
+func TestEvalScriptFunctions(t *testing.T) {
+	is := assert.New(t)
+	template := newFakeTemplate(t)
+	template.Scripts.UseFunctions("sugar_test")
+	ctx := context.Background()
+	script := NewScript("sugar_test_double", `return tonumber(ARGV[1]) * 2`)
+	val, err := template.EvalScript(ctx, script, nil, 21).Int64()
+	is.NoError(err)
+	is.Equal(int64(42), val)
+	val, err = template.EvalScript(ctx, script, nil, 5).Int64()
+	is.NoError(err)
+	is.Equal(int64(10), val)
+}
@@ -8,6 +8,8 @@
 package caches
 
 import (
+	"context"
+	"strings"
 	"time"
 )
 
@@ -31,4 +33,46 @@ type CacheTemplate interface {
 	ExpireSetup(key string, time time.Time) bool
 	// GetExpire 获取一个Key的剩余有效期
 	GetExpire(key string) (time.Duration, error)
+	// MSet 批量设置缓存,每个缓存可以有各自的有效期
+	MSet(items ...Item) error
+	// Incr 将计数器加1,返回加1后的值
+	Incr(key string, opts ...CounterOption) (int64, error)
+	// IncrBy 将计数器增加delta,返回增加后的值
+	IncrBy(key string, delta int64, opts ...CounterOption) (int64, error)
+	// IncrByFloat 将计数器增加浮点数delta,返回增加后的值
+	IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error)
+	// Decr 将计数器减1,返回减1后的值
+	Decr(key string, opts ...CounterOption) (int64, error)
+}
+
+// Item 批量设置的一个缓存
+type Item struct {
+	Key   string
+	Value any
+	// 有效期,不大于0时永不过期,为 redis.KeepTTL 时保留原有效期
+	Expire time.Duration
+}
+
+// ContextTemplate 支持绑定调用方上下文的缓存模板
+type ContextTemplate interface {
+	CacheTemplate
+	// WithContext 返回一个绑定了ctx的模板副本
+	WithContext(ctx context.Context) CacheTemplate
+}
+
+// BindContext 如果模板支持绑定上下文,则返回绑定了ctx的模板副本,否则原样返回
+func BindContext(template CacheTemplate, ctx context.Context) CacheTemplate {
+	if t, ok := template.(ContextTemplate); ok {
+		return t.WithContext(ctx)
+	}
+	return template
+}
+
+// KeyNamespace 获取Key的命名空间,即第一个`:`之前的部分,没有`:`则返回Key本身
+// 用于指标或者链路追踪的属性,避免以完整的Key作为属性值导致基数爆炸
+func KeyNamespace(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
 }
@@ -0,0 +1,208 @@
+/**
+  @author: Zero
+  @date: 2023/6/18 11:20:09
+  @desc: 基于OpenTelemetry链路追踪的缓存模板装饰器
+
+**/
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// 链路追踪属性
+const (
+	// 缓存操作名称
+	attrCacheOperation = attribute.Key("cache.operation")
+	// 缓存Key的命名空间
+	attrCacheNamespace = attribute.Key("cache.key_namespace")
+	// 缓存操作结果
+	attrCacheResult = attribute.Key("cache.result")
+)
+
+// TracingTemplate 为任意缓存模板的每次操作创建一个Span
+// 通过 WithContext 绑定调用方上下文后,Span将挂载到调用方的链路之下
+type TracingTemplate struct {
+	// 被装饰的缓存模板
+	template CacheTemplate
+	// 链路追踪器
+	tracer trace.Tracer
+	// 调用方上下文
+	ctx context.Context
+}
+
+// NewTracingTemplate 使用链路追踪器装饰一个缓存模板
+func NewTracingTemplate(template CacheTemplate, tracer trace.Tracer) *TracingTemplate {
+	return &TracingTemplate{
+		template: template,
+		tracer:   tracer,
+		ctx:      defaultCtx,
+	}
+}
+
+// WithContext 返回一个绑定了ctx的模板副本,Span将以ctx中的Span作为父级
+func (t *TracingTemplate) WithContext(ctx context.Context) CacheTemplate {
+	return &TracingTemplate{
+		template: t.template,
+		tracer:   t.tracer,
+		ctx:      ctx,
+	}
+}
+
+// 开启一个缓存操作的Span,返回绑定了该Span上下文的模板
+func (t *TracingTemplate) start(op, key string) (CacheTemplate, trace.Span) {
+	ctx, span := t.tracer.Start(t.ctx, "cache."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrCacheOperation.String(op), attrCacheNamespace.String(KeyNamespace(key))))
+	return BindContext(t.template, ctx), span
+}
+
+// 结束Span,记录操作结果
+func endSpan(span trace.Span, result string, err error) {
+	span.SetAttributes(attrCacheResult.String(result))
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Set 设置一个缓存
+func (t *TracingTemplate) Set(key string, value any) error {
+	template, span := t.start("Set", key)
+	err := template.Set(key, value)
+	endSpan(span, errResult(err), err)
+	return err
+}
+
+// SetExpire 设置一个带有有效期的缓存
+func (t *TracingTemplate) SetExpire(key string, value any, expire time.Duration) error {
+	template, span := t.start("SetExpire", key)
+	err := template.SetExpire(key, value, expire)
+	endSpan(span, errResult(err), err)
+	return err
+}
+
+// Get 获取一个缓存
+func (t *TracingTemplate) Get(key string) *Reply {
+	template, span := t.start("Get", key)
+	reply := template.Get(key)
+	switch err := reply.Err(); {
+	case reply.tombstone():
+		endSpan(span, metrics.CacheAbsent, nil)
+	case err == nil:
+		endSpan(span, metrics.CacheHit, nil)
+	case errors.Is(err, redis.Nil):
+		endSpan(span, metrics.CacheMiss, nil)
+	default:
+		endSpan(span, metrics.CacheError, err)
+	}
+	return reply
+}
+
+// Del 删除一个或者多个缓存
+func (t *TracingTemplate) Del(keys ...string) error {
+	var key string
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+	template, span := t.start("Del", key)
+	err := template.Del(keys...)
+	endSpan(span, errResult(err), err)
+	return err
+}
+
+// Exists 检查一个缓存是否存在
+func (t *TracingTemplate) Exists(key string) bool {
+	template, span := t.start("Exists", key)
+	ok := template.Exists(key)
+	endSpan(span, boolResult(ok), nil)
+	return ok
+}
+
+// Keys 匹配所有符合规则的Key
+func (t *TracingTemplate) Keys(pattern string) []string {
+	template, span := t.start("Keys", pattern)
+	keys := template.Keys(pattern)
+	endSpan(span, metrics.CacheOk, nil)
+	return keys
+}
+
+// ExpireAdd 延长有效期
+func (t *TracingTemplate) ExpireAdd(key string, expire time.Duration) bool {
+	template, span := t.start("ExpireAdd", key)
+	ok := template.ExpireAdd(key, expire)
+	endSpan(span, boolResult(ok), nil)
+	return ok
+}
+
+// ExpireSetup 设置有效期为指定时间
+func (t *TracingTemplate) ExpireSetup(key string, at time.Time) bool {
+	template, span := t.start("ExpireSetup", key)
+	ok := template.ExpireSetup(key, at)
+	endSpan(span, boolResult(ok), nil)
+	return ok
+}
+
+// GetExpire 获取一个Key的剩余有效期
+func (t *TracingTemplate) GetExpire(key string) (time.Duration, error) {
+	template, span := t.start("GetExpire", key)
+	ttl, err := template.GetExpire(key)
+	endSpan(span, errResult(err), err)
+	return ttl, err
+}
+
+// MSet 批量设置缓存
+func (t *TracingTemplate) MSet(items ...Item) error {
+	var key string
+	if len(items) > 0 {
+		key = items[0].Key
+	}
+	template, span := t.start("MSet", key)
+	err := template.MSet(items...)
+	endSpan(span, errResult(err), err)
+	return err
+}
+
+// Incr 将计数器加1
+func (t *TracingTemplate) Incr(key string, opts ...CounterOption) (int64, error) {
+	template, span := t.start("Incr", key)
+	n, err := template.Incr(key, opts...)
+	endSpan(span, errResult(err), err)
+	return n, err
+}
+
+// IncrBy 将计数器增加delta
+func (t *TracingTemplate) IncrBy(key string, delta int64, opts ...CounterOption) (int64, error) {
+	template, span := t.start("IncrBy", key)
+	n, err := template.IncrBy(key, delta, opts...)
+	endSpan(span, errResult(err), err)
+	return n, err
+}
+
+// IncrByFloat 将计数器增加浮点数delta
+func (t *TracingTemplate) IncrByFloat(key string, delta float64, opts ...CounterOption) (float64, error) {
+	template, span := t.start("IncrByFloat", key)
+	f, err := template.IncrByFloat(key, delta, opts...)
+	endSpan(span, errResult(err), err)
+	return f, err
+}
+
+// Decr 将计数器减1
+func (t *TracingTemplate) Decr(key string, opts ...CounterOption) (int64, error) {
+	template, span := t.start("Decr", key)
+	n, err := template.Decr(key, opts...)
+	endSpan(span, errResult(err), err)
+	return n, err
+}
+
+// 确保实现了 ContextTemplate
+var _ ContextTemplate = (*TracingTemplate)(nil)
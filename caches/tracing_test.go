@@ -0,0 +1,46 @@
+/**
+  @author: Zero
+  @date: 2023/6/18 15:02:18
+  @desc: 缓存链路追踪单元测试
+
+**/
+
+package caches
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// 测试缓存操作的Span挂载在调用方链路之下
+func TestTracingTemplate(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	redisTemplate := newFakeTemplate(t)
+	template := NewTracingTemplate(&redisTemplate, tracer)
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	bound := template.WithContext(ctx)
+	is.NoError(bound.SetExpire("tracing:k1", "v1", time.Second*10))
+	is.True(bound.Get("tracing:k1").Ok())
+	is.False(bound.Get("tracing:k2").Ok())
+	parent.End()
+
+	spans := exporter.GetSpans()
+	is.Len(spans, 4)
+	for _, span := range spans[:3] {
+		is.Equal(parent.SpanContext().SpanID(), span.Parent.SpanID())
+		is.Contains(span.Attributes, attribute.String("cache.key_namespace", "tracing"))
+	}
+	is.Equal("cache.Get", spans[1].Name)
+	is.Contains(spans[1].Attributes, attribute.String("cache.result", "hit"))
+	is.Contains(spans[2].Attributes, attribute.String("cache.result", "miss"))
+}
@@ -0,0 +1,82 @@
+/**
+  @author: Zero
+  @date: 2023/7/15 10:08:26
+  @desc: 时钟抽象,用于在测试中控制有效期、重试以及看门狗的时间
+
+**/
+
+package clock
+
+import "time"
+
+// Clock 时钟接口,组件中所有与时间相关的计算都通过该接口完成
+// 默认使用系统时钟,测试时可以注入 Fake 手动推进时间
+type Clock interface {
+	// Now 当前时间
+	Now() time.Time
+	// Since 从t到现在经过的时长
+	Since(t time.Time) time.Duration
+	// Until 从现在到t的时长
+	Until(t time.Time) time.Duration
+	// After 等待d后向返回的通道发送当前时间
+	After(d time.Duration) <-chan time.Time
+	// NewTimer 创建一个在d后触发的定时器
+	NewTimer(d time.Duration) Timer
+	// NewTicker 创建一个每隔d触发一次的周期定时器
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer 定时器,对应 time.Timer
+type Timer interface {
+	// C 定时器触发时接收当前时间的通道
+	C() <-chan time.Time
+	// Stop 停止定时器,定时器已触发或已停止时返回false
+	Stop() bool
+}
+
+// Ticker 周期定时器,对应 time.Ticker
+type Ticker interface {
+	// C 每次触发时接收当前时间的通道
+	C() <-chan time.Time
+	// Stop 停止周期定时器
+	Stop()
+}
+
+// Real 返回系统时钟
+func Real() Clock {
+	return realClock{}
+}
+
+// OrReal 如果c为nil则返回系统时钟,否则原样返回
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+// 系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Until(t time.Time) time.Duration        { return time.Until(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,186 @@
+/**
+  @author: Zero
+  @date: 2023/7/15 10:36:50
+  @desc: 手动推进的时钟,用于确定性的测试
+
+**/
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake 手动推进的时钟,只有调用 Advance 或者 Set 时时间才会前进
+// 到期的定时器按触发时间的先后依次触发,与系统定时器一样,通道已满时丢弃本次触发
+type Fake struct {
+	mu sync.Mutex
+	// 当前时间
+	now time.Time
+	// 等待触发的定时器
+	waiters []*fakeWaiter
+	// 定时器数量发生变化时通知 BlockUntil
+	changed *sync.Cond
+}
+
+// 一个等待触发的定时器
+type fakeWaiter struct {
+	clock *Fake
+	// 触发时间
+	deadline time.Time
+	// 周期,为0表示只触发一次
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewFake 创建一个从now开始的手动时钟
+func NewFake(now time.Time) *Fake {
+	fake := &Fake{now: now}
+	fake.changed = sync.NewCond(&fake.mu)
+	return fake
+}
+
+// Now 当前时间
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since 从t到现在经过的时长
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until 从现在到t的时长
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// After 等待d后向返回的通道发送当前时间
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer 创建一个在d后触发的定时器
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0)
+}
+
+// NewTicker 创建一个每隔d触发一次的周期定时器
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for Fake.NewTicker")
+	}
+	return fakeTicker{f.add(d, d)}
+}
+
+// 添加一个定时器,到期时间不晚于当前时间的立即触发
+func (f *Fake) add(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	waiter := &fakeWaiter{
+		clock:    f,
+		deadline: f.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+	}
+	if d <= 0 && period == 0 {
+		waiter.ch <- f.now
+		return waiter
+	}
+	f.waiters = append(f.waiters, waiter)
+	f.changed.Broadcast()
+	return waiter
+}
+
+// 移除一个定时器,返回是否仍在等待
+func (f *Fake) remove(waiter *fakeWaiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, w := range f.waiters {
+		if w == waiter {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// Advance 将时间推进d,并依次触发期间到期的定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set 将时间设置为t,并依次触发期间到期的定时器,t早于当前时间时只修改时间
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		// 找到最早到期的定时器
+		var next *fakeWaiter
+		for _, w := range f.waiters {
+			if !w.deadline.After(t) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.deadline.After(f.now) {
+			f.now = next.deadline
+		}
+		select {
+		case next.ch <- f.now:
+		default:
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+			continue
+		}
+		for i, w := range f.waiters {
+			if w == next {
+				f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+				break
+			}
+		}
+		f.changed.Broadcast()
+	}
+	f.now = t
+}
+
+// Waiters 等待触发的定时器数量
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil 阻塞直到等待触发的定时器数量不少于n
+// 用于在推进时间前,确认被测试的协程已经开始等待
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	return w.clock.remove(w)
+}
+
+// 周期定时器
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
@@ -0,0 +1,68 @@
+/**
+  @author: Zero
+  @date: 2023/7/15 11:20:05
+  @desc: 手动时钟单元测试
+
+**/
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试定时器只有在推进时间后才触发
+func TestFake_Timer(t *testing.T) {
+	is := assert.New(t)
+	start := time.Date(2023, 7, 15, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	timer := fake.NewTimer(time.Second)
+	after := fake.After(time.Minute)
+	is.Equal(2, fake.Waiters())
+
+	fake.Advance(time.Millisecond * 999)
+	is.Empty(timer.C())
+	fake.Advance(time.Millisecond)
+	is.Equal(start.Add(time.Second), <-timer.C())
+	is.False(timer.Stop())
+
+	fake.Advance(time.Hour)
+	is.Equal(start.Add(time.Minute), <-after)
+	is.Equal(start.Add(time.Hour+time.Second), fake.Now())
+	is.Equal(0, fake.Waiters())
+}
+
+// 测试周期定时器按周期触发,通道已满时丢弃
+func TestFake_Ticker(t *testing.T) {
+	is := assert.New(t)
+	start := time.Date(2023, 7, 15, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	ticker := fake.NewTicker(time.Second)
+	fake.Advance(time.Second)
+	is.Equal(start.Add(time.Second), <-ticker.C())
+	fake.Advance(time.Second * 3)
+	is.Equal(start.Add(time.Second*2), <-ticker.C())
+	is.Empty(ticker.C())
+	ticker.Stop()
+	fake.Advance(time.Second)
+	is.Empty(ticker.C())
+	is.Equal(time.Second*5, fake.Since(start))
+}
+
+// 测试等待协程开始等待定时器
+func TestFake_BlockUntil(t *testing.T) {
+	is := assert.New(t)
+	fake := NewFake(time.Now())
+	done := make(chan struct{})
+	go func() {
+		<-fake.After(time.Second)
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	<-done
+	is.Equal(0, fake.Waiters())
+}
@@ -0,0 +1,134 @@
+/**
+  @author: Zero
+  @date: 2023/7/2 14:05:18
+  @desc: Redis分布式锁管理命令行工具
+
+**/
+
+// sugar-locks 用于排查问题时查询、强制释放Redis分布式锁
+//
+//	sugar-locks [-addr 127.0.0.1:6379] [-password xxx] [-db 0] <command> [args]
+//
+//	list <pattern>        列出所有匹配pattern的锁
+//	show <key>            查看一把锁的持有信息
+//	release <key>         强制释放一把锁
+//	expire <key> <ttl>    强制设置一把锁的剩余有效期,例如 expire order:1 5s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/locks"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6379", "redis address")
+	password := flag.String("password", "", "redis password")
+	db := flag.Int("db", 0, "redis database")
+	timeout := flag.Duration("timeout", time.Second*10, "command timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	admin := locks.NewAdmin(caches.RedisTemplate{
+		Client: redis.NewClient(&redis.Options{Addr: *addr, Password: *password, DB: *db}),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := run(ctx, admin, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), `usage: sugar-locks [flags] <command> [args]
+
+commands:
+  list <pattern>        list held locks matching pattern
+  show <key>            show lock owner, metadata, acquire time, ttl and fence
+  release <key>         force release a lock
+  expire <key> <ttl>    force set the remaining ttl of a lock
+
+flags:`)
+	flag.PrintDefaults()
+}
+
+// 执行子命令
+func run(ctx context.Context, admin *locks.Admin, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		flag.Usage()
+		return fmt.Errorf("missing command arguments")
+	}
+	switch command, key := args[0], args[1]; command {
+	case "list":
+		infos, err := admin.List(ctx, key)
+		if err != nil {
+			return err
+		}
+		printInfos(out, infos...)
+	case "show":
+		info, err := admin.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		printInfos(out, *info)
+	case "release":
+		if err := admin.ForceRelease(ctx, key); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "released %s\n", key)
+	case "expire":
+		if len(args) < 3 {
+			return fmt.Errorf("missing ttl argument")
+		}
+		ttl, err := time.ParseDuration(args[2])
+		if err != nil {
+			return err
+		}
+		if err = admin.ForceExpire(ctx, key, ttl); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "expire %s in %v\n", key, ttl)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+// 以表格形式输出锁的持有信息
+func printInfos(out io.Writer, infos ...locks.LockInfo) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tOWNER\tSERVICE\tHOST\tPID\tACQUIRED AT\tHELD\tTTL\tFENCE")
+	for _, info := range infos {
+		acquiredAt, held, ttl, service, host, pid := "-", "-", "-", "-", "-", "-"
+		if info.Service != "" {
+			service = info.Service
+		}
+		if info.Hostname != "" {
+			host = info.Hostname
+		}
+		if info.PID > 0 {
+			pid = strconv.Itoa(info.PID)
+		}
+		if !info.AcquiredAt.IsZero() {
+			acquiredAt = info.AcquiredAt.Format(time.RFC3339)
+			held = time.Since(info.AcquiredAt).Truncate(time.Millisecond).String()
+		}
+		// 负数表示没有设置有效期
+		if info.TTL >= 0 {
+			ttl = info.TTL.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			info.Key, info.Token, service, host, pid, acquiredAt, held, ttl, info.Fence)
+	}
+	w.Flush()
+}
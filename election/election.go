@@ -0,0 +1,184 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 10:15:40
+  @desc: 基于分布式锁的选主组件
+
+**/
+
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zlx2019/toys/randoms"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// NoLeaderErr 当前没有leader
+	NoLeaderErr = errors.New("election no leader")
+	// NotLeaderErr 当前实例不是leader
+	NotLeaderErr = errors.New("election not leader")
+	// CampaigningErr 当前实例正在竞选
+	CampaigningErr = errors.New("election campaign in progress")
+	// CampaignResignedErr 竞选期间调用了 Resign,本次竞选被中断
+	CampaignResignedErr = errors.New("election campaign resigned")
+)
+
+// Backend 选主后端,由具体的分布式锁实现
+type Backend interface {
+	// Identity 返回候选者的身份标识
+	Identity() string
+	// Campaign 参与竞选,阻塞直到当选或者ctx被取消
+	Campaign(ctx context.Context) error
+	// Resign 放弃leader身份
+	Resign(ctx context.Context) error
+	// Leader 返回当前leader的身份标识,没有leader时返回 NoLeaderErr
+	Leader(ctx context.Context) (string, error)
+	// Done 返回本次任期的结束通知,leader身份丢失时关闭
+	Done() <-chan struct{}
+}
+
+// Option 选主配置选项
+type Option func(election *Election)
+
+// OnElected 设置当选leader后的回调
+func OnElected(fn func(identity string)) Option {
+	return func(election *Election) {
+		election.onElected = fn
+	}
+}
+
+// OnDemoted 设置失去leader身份后的回调,主动放弃或者身份丢失都会触发
+func OnDemoted(fn func(identity string)) Option {
+	return func(election *Election) {
+		election.onDemoted = fn
+	}
+}
+
+// Election 选主组件,同一时刻只有一个候选者能成为leader
+type Election struct {
+	// 选主后端
+	backend Backend
+	// 当前是否为leader
+	leader atomic.Bool
+	// 本次任期的结束信号,放弃leader时关闭
+	term chan struct{}
+	// 正在进行的竞选的取消函数,为nil表示没有正在进行的竞选
+	cancelCampaign context.CancelCauseFunc
+	mu             sync.Mutex
+	// 当选回调
+	onElected func(identity string)
+	// 失去leader身份回调
+	onDemoted func(identity string)
+}
+
+// New 使用选主后端创建选主组件
+func New(backend Backend, opts ...Option) *Election {
+	election := &Election{backend: backend}
+	for _, opt := range opts {
+		opt(election)
+	}
+	return election
+}
+
+// Campaign 参与竞选,阻塞直到当选或者ctx被取消
+// 当选后如果leader身份丢失,将触发 OnDemoted 回调,可以再次调用 Campaign 重新竞选
+// 竞选期间调用 Resign 会中断竞选,返回 CampaignResignedErr
+func (e *Election) Campaign(ctx context.Context) error {
+	e.mu.Lock()
+	if e.leader.Load() {
+		e.mu.Unlock()
+		return nil
+	}
+	if e.cancelCampaign != nil {
+		e.mu.Unlock()
+		return CampaigningErr
+	}
+	campaignCtx, cancel := context.WithCancelCause(ctx)
+	e.cancelCampaign = cancel
+	e.mu.Unlock()
+
+	// 竞选会一直阻塞,期间不持有互斥锁,以便 Resign 能够中断竞选
+	err := e.backend.Campaign(campaignCtx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancelCampaign = nil
+	resigned := errors.Is(context.Cause(campaignCtx), CampaignResignedErr)
+	cancel(nil)
+	if resigned {
+		if err == nil {
+			// 当选的同时被 Resign 中断,立即放弃leader身份
+			return errors.Join(CampaignResignedErr, e.backend.Resign(context.WithoutCancel(ctx)))
+		}
+		return CampaignResignedErr
+	}
+	if err != nil {
+		return err
+	}
+	e.leader.Store(true)
+	term := make(chan struct{})
+	e.term = term
+	if e.onElected != nil {
+		e.onElected(e.backend.Identity())
+	}
+	// 监听leader身份丢失
+	done := e.backend.Done()
+	go func() {
+		select {
+		case <-done:
+			e.demote()
+		case <-term:
+		}
+	}()
+	return nil
+}
+
+// Resign 放弃leader身份,正在竞选时中断竞选
+func (e *Election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leader.Load() {
+		if e.cancelCampaign != nil {
+			e.cancelCampaign(CampaignResignedErr)
+			return nil
+		}
+		return NotLeaderErr
+	}
+	close(e.term)
+	err := e.backend.Resign(ctx)
+	e.demote()
+	return err
+}
+
+// 失去leader身份
+func (e *Election) demote() {
+	if e.leader.CompareAndSwap(true, false) && e.onDemoted != nil {
+		e.onDemoted(e.backend.Identity())
+	}
+}
+
+// IsLeader 当前实例是否为leader
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Leader 返回当前leader的身份标识
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	return e.backend.Leader(ctx)
+}
+
+// Identity 返回当前实例的身份标识
+func (e *Election) Identity() string {
+	return e.backend.Identity()
+}
+
+// DefaultIdentity 生成默认的候选者身份标识: 主机名-进程ID-随机字符串
+func DefaultIdentity() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), randoms.RandomString(6))
+}
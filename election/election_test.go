@@ -0,0 +1,108 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 15:30:22
+  @desc: 选主组件单元测试
+
+**/
+
+package election
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/redisfake"
+	"github.com/zlx2019/sugar/locks"
+)
+
+// 测试Redis选主,leader放弃后由其他候选者当选
+func TestRedisElection(t *testing.T) {
+	is := assert.New(t)
+	template := redisfake.New(t)
+	elected := make(chan string, 2)
+	demoted := make(chan string, 2)
+	opts := []Option{
+		OnElected(func(identity string) { elected <- identity }),
+		OnDemoted(func(identity string) { demoted <- identity }),
+	}
+	e1 := New(NewRedisBackend("election:scheduler", "node-1", template, locks.WithExpire(time.Second)), opts...)
+	e2 := New(NewRedisBackend("election:scheduler", "node-2", template, locks.WithExpire(time.Second)).
+		WithRetryInterval(time.Millisecond*100), opts...)
+
+	is.NoError(e1.Campaign(context.Background()))
+	is.True(e1.IsLeader())
+	is.Equal("node-1", <-elected)
+
+	// node-2 竞选超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	is.ErrorIs(e2.Campaign(ctx), context.DeadlineExceeded)
+	is.False(e2.IsLeader())
+	// 看门狗续约,超过锁的有效期后仍然是leader
+	time.Sleep(time.Millisecond * 1500)
+	leader, err := e2.Leader(context.Background())
+	is.NoError(err)
+	is.Equal("node-1", leader)
+
+	// node-1 放弃后 node-2 当选
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		is.NoError(e1.Resign(context.Background()))
+	}()
+	is.NoError(e2.Campaign(context.Background()))
+	is.Equal("node-1", <-demoted)
+	is.Equal("node-2", <-elected)
+	is.False(e1.IsLeader())
+	is.ErrorIs(e1.Resign(context.Background()), NotLeaderErr)
+
+	is.NoError(e2.Resign(context.Background()))
+	_, err = e1.Leader(context.Background())
+	is.ErrorIs(err, NoLeaderErr)
+}
+
+// 测试leader锁丢失后触发降级回调
+func TestRedisElection_Lost(t *testing.T) {
+	is := assert.New(t)
+	template := redisfake.New(t)
+	demoted := make(chan string, 1)
+	e := New(NewRedisBackend("election:consumer", "", template, locks.WithExpire(time.Second)),
+		OnDemoted(func(identity string) { demoted <- identity }))
+	is.NoError(e.Campaign(context.Background()))
+	is.NoError(template.Del("election:consumer"))
+	select {
+	case identity := <-demoted:
+		is.Equal(e.Identity(), identity)
+	case <-time.After(time.Second * 3):
+		t.Fatal("demoted not notified")
+	}
+	is.False(e.IsLeader())
+}
+
+// 测试竞选期间放弃竞选,Resign 不会被阻塞
+func TestRedisElection_ResignCampaign(t *testing.T) {
+	is := assert.New(t)
+	template := redisfake.New(t)
+	e1 := New(NewRedisBackend("election:resign", "node-1", template, locks.WithExpire(time.Second)))
+	e2 := New(NewRedisBackend("election:resign", "node-2", template, locks.WithExpire(time.Second)).
+		WithRetryInterval(time.Millisecond*50))
+	is.NoError(e1.Campaign(context.Background()))
+
+	result := make(chan error, 1)
+	go func() {
+		result <- e2.Campaign(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 200)
+	is.ErrorIs(e2.Campaign(context.Background()), CampaigningErr)
+	is.NoError(e2.Resign(context.Background()))
+	select {
+	case err := <-result:
+		is.ErrorIs(err, CampaignResignedErr)
+	case <-time.After(time.Second * 3):
+		t.Fatal("campaign not interrupted")
+	}
+	is.False(e2.IsLeader())
+	is.True(e1.IsLeader())
+	is.NoError(e1.Resign(context.Background()))
+}
@@ -0,0 +1,139 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 14:20:36
+  @desc: 基于Etcd的选主后端
+
+**/
+
+package election
+
+import (
+	"context"
+	"errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"sync"
+)
+
+// 默认的租约有效期,单位秒
+const defaultSessionTTL = 10
+
+// EtcdBackend 基于Etcd租约的选主后端
+// 租约由会话自动续约,相当于Redis锁的看门狗
+type EtcdBackend struct {
+	// Etcd客户端
+	client *clientv3.Client
+	// 选主的Key前缀
+	prefix string
+	// 候选者身份标识
+	identity string
+	// 租约有效期,单位秒
+	ttl int
+
+	mu sync.Mutex
+	// 当前会话,会话过期后重新创建
+	session *concurrency.Session
+	// 当前会话上的选举
+	election *concurrency.Election
+}
+
+// NewEtcdBackend 创建一个Etcd选主后端,identity 为空时使用 DefaultIdentity()
+func NewEtcdBackend(client *clientv3.Client, prefix, identity string) *EtcdBackend {
+	if identity == "" {
+		identity = DefaultIdentity()
+	}
+	return &EtcdBackend{
+		client:   client,
+		prefix:   prefix,
+		identity: identity,
+		ttl:      defaultSessionTTL,
+	}
+}
+
+// WithSessionTTL 设置租约有效期,单位秒
+func (b *EtcdBackend) WithSessionTTL(ttl int) *EtcdBackend {
+	b.ttl = ttl
+	return b
+}
+
+// Identity 返回候选者的身份标识
+func (b *EtcdBackend) Identity() string {
+	return b.identity
+}
+
+// 获取可用的会话,会话已过期则重新创建
+func (b *EtcdBackend) current() (*concurrency.Election, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil {
+		select {
+		case <-b.session.Done():
+			b.session = nil
+		default:
+			return b.election, nil
+		}
+	}
+	session, err := concurrency.NewSession(b.client, concurrency.WithTTL(b.ttl))
+	if err != nil {
+		return nil, err
+	}
+	b.session = session
+	b.election = concurrency.NewElection(session, b.prefix)
+	return b.election, nil
+}
+
+// Campaign 参与竞选,阻塞直到当选或者ctx被取消
+func (b *EtcdBackend) Campaign(ctx context.Context) error {
+	election, err := b.current()
+	if err != nil {
+		return err
+	}
+	return election.Campaign(ctx, b.identity)
+}
+
+// Resign 放弃leader身份
+func (b *EtcdBackend) Resign(ctx context.Context) error {
+	election, err := b.current()
+	if err != nil {
+		return err
+	}
+	return election.Resign(ctx)
+}
+
+// Leader 返回当前leader的身份标识
+func (b *EtcdBackend) Leader(ctx context.Context) (string, error) {
+	election, err := b.current()
+	if err != nil {
+		return "", err
+	}
+	resp, err := election.Leader(ctx)
+	if errors.Is(err, concurrency.ErrElectionNoLeader) {
+		return "", NoLeaderErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Done 返回会话的结束通知,租约过期时关闭
+func (b *EtcdBackend) Done() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session == nil {
+		return nil
+	}
+	return b.session.Done()
+}
+
+// Close 关闭会话并撤销租约
+func (b *EtcdBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session == nil {
+		return nil
+	}
+	err := b.session.Close()
+	b.session = nil
+	return err
+}
@@ -0,0 +1,10 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 16:05:48
+  @desc: Etcd选主后端的集成测试
+
+**/
+
+// Package etcdtest 通过进程内的Etcd节点测试 election.EtcdBackend
+// 位于独立的模块中,避免库的使用者继承 go.etcd.io/etcd/server/v3 依赖,在该目录下执行 go test ./... 运行
+package etcdtest
@@ -0,0 +1,134 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 16:05:48
+  @desc: 基于进程内Etcd节点的选主后端测试
+
+**/
+
+package etcdtest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/election"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// 启动一个进程内的Etcd节点,返回连接到该节点的客户端,测试结束时自动关闭
+func newEmbedEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	// 使用随机端口,避免与本机的Etcd以及并行的测试冲突
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*local}, []url.URL{*local}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*local}, []url.URL{*local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(time.Second * 10):
+		t.Fatal("embed etcd not ready")
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{server.Clients[0].Addr().String()},
+		DialTimeout: time.Second * 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// 测试Etcd选主,leader放弃后由其他候选者当选
+func TestEtcdElection(t *testing.T) {
+	is := assert.New(t)
+	client := newEmbedEtcd(t)
+	b1 := election.NewEtcdBackend(client, "/election/scheduler", "node-1")
+	b2 := election.NewEtcdBackend(client, "/election/scheduler", "node-2")
+	defer b1.Close()
+	defer b2.Close()
+	elected := make(chan string, 2)
+	e1 := election.New(b1, election.OnElected(func(identity string) { elected <- identity }))
+	e2 := election.New(b2, election.OnElected(func(identity string) { elected <- identity }))
+
+	_, err := e1.Leader(context.Background())
+	is.ErrorIs(err, election.NoLeaderErr)
+	is.NoError(e1.Campaign(context.Background()))
+	is.Equal("node-1", <-elected)
+	leader, err := e2.Leader(context.Background())
+	is.NoError(err)
+	is.Equal("node-1", leader)
+
+	// node-2 竞选超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	is.ErrorIs(e2.Campaign(ctx), context.DeadlineExceeded)
+	is.False(e2.IsLeader())
+
+	// node-1 放弃后 node-2 当选
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		is.NoError(e1.Resign(context.Background()))
+	}()
+	is.NoError(e2.Campaign(context.Background()))
+	is.Equal("node-2", <-elected)
+	is.False(e1.IsLeader())
+	leader, err = e1.Leader(context.Background())
+	is.NoError(err)
+	is.Equal("node-2", leader)
+}
+
+// 测试Etcd会话关闭后触发降级回调
+func TestEtcdElection_Lost(t *testing.T) {
+	is := assert.New(t)
+	backend := election.NewEtcdBackend(newEmbedEtcd(t), "/election/consumer", "")
+	demoted := make(chan string, 1)
+	e := election.New(backend, election.OnDemoted(func(identity string) { demoted <- identity }))
+	is.NoError(e.Campaign(context.Background()))
+	// 撤销租约,相当于会话过期
+	is.NoError(backend.Close())
+	select {
+	case identity := <-demoted:
+		is.Equal(e.Identity(), identity)
+	case <-time.After(time.Second * 3):
+		t.Fatal("demoted not notified")
+	}
+	is.False(e.IsLeader())
+}
+
+// 测试Etcd竞选期间放弃竞选
+func TestEtcdElection_ResignCampaign(t *testing.T) {
+	is := assert.New(t)
+	client := newEmbedEtcd(t)
+	leader := election.NewEtcdBackend(client, "/election/resign", "node-1")
+	defer leader.Close()
+	is.NoError(election.New(leader).Campaign(context.Background()))
+
+	e := election.New(election.NewEtcdBackend(client, "/election/resign", "node-2"))
+	result := make(chan error, 1)
+	go func() {
+		result <- e.Campaign(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 200)
+	is.NoError(e.Resign(context.Background()))
+	select {
+	case err := <-result:
+		is.ErrorIs(err, election.CampaignResignedErr)
+	case <-time.After(time.Second * 3):
+		t.Fatal("campaign not interrupted")
+	}
+	is.False(e.IsLeader())
+}
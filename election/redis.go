@@ -0,0 +1,96 @@
+/**
+  @author: Zero
+  @date: 2023/6/28 11:02:13
+  @desc: 基于Redis分布式锁的选主后端
+
+**/
+
+package election
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/locks"
+	"time"
+)
+
+// 默认的竞选重试间隔
+const defaultRetryInterval = time.Second
+
+// RedisBackend 基于Redis分布式锁的选主后端
+// 候选者的身份标识作为锁的value,leader身份由看门狗持续续约
+type RedisBackend struct {
+	// Redis客户端
+	template caches.RedisTemplate
+	// 选主的Key
+	key string
+	// 候选者身份标识
+	identity string
+	// 竞选失败后的重试间隔
+	retryInterval time.Duration
+	// leader锁
+	lock *locks.RedisDistributedLock
+}
+
+// NewRedisBackend 创建一个Redis选主后端
+// identity 为空时使用 DefaultIdentity(),opts 为leader锁的配置选项,看门狗始终启用
+func NewRedisBackend(key, identity string, template caches.RedisTemplate, opts ...locks.LockOption) *RedisBackend {
+	if identity == "" {
+		identity = DefaultIdentity()
+	}
+	opts = append(opts, locks.WithToken(identity), locks.WithWatchDog())
+	return &RedisBackend{
+		template:      template,
+		key:           key,
+		identity:      identity,
+		retryInterval: defaultRetryInterval,
+		lock:          locks.NewRedisDistributedLock(key, template, opts...),
+	}
+}
+
+// WithRetryInterval 设置竞选失败后的重试间隔
+func (b *RedisBackend) WithRetryInterval(interval time.Duration) *RedisBackend {
+	b.retryInterval = interval
+	return b
+}
+
+// Identity 返回候选者的身份标识
+func (b *RedisBackend) Identity() string {
+	return b.identity
+}
+
+// Campaign 循环尝试获取leader锁,直到成功或者ctx被取消
+func (b *RedisBackend) Campaign(ctx context.Context) error {
+	for {
+		// 当选后的续约不受竞选上下文的影响
+		if err := b.lock.Lock(context.WithoutCancel(ctx)); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.retryInterval):
+		}
+	}
+}
+
+// Resign 释放leader锁
+func (b *RedisBackend) Resign(ctx context.Context) error {
+	return b.lock.Unlock(ctx)
+}
+
+// Leader 读取leader锁的value,即leader的身份标识
+func (b *RedisBackend) Leader(ctx context.Context) (string, error) {
+	leader, err := b.template.Client.Get(ctx, b.key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", NoLeaderErr
+	}
+	return leader, err
+}
+
+// Done 返回leader锁的丢失通知
+func (b *RedisBackend) Done() <-chan struct{} {
+	return b.lock.Lost()
+}
@@ -0,0 +1,103 @@
+/**
+  @author: Zero
+  @date: 2023/7/22 11:05:14
+  @desc: 基于进程内存的幂等存储后端
+
+**/
+
+package idempotency
+
+import (
+	"context"
+	"github.com/zlx2019/sugar/clock"
+	"sync"
+	"time"
+)
+
+// 每占用多少次清理一次过期的记录
+const sweepEvery = 1024
+
+// 进程内存储后端,语义与Redis后端一致
+type memoryBackend struct {
+	clock   clock.Clock
+	mu      sync.Mutex
+	records map[string]*memoryRecord
+	// 距离上次清理占用的次数
+	claims int
+}
+
+// 一个幂等Key的记录
+type memoryRecord struct {
+	state  string
+	token  string
+	result string
+	// 过期时间,零值表示永不过期
+	expireAt time.Time
+}
+
+func newMemoryBackend(c clock.Clock) *memoryBackend {
+	return &memoryBackend{clock: c, records: make(map[string]*memoryRecord)}
+}
+
+// 获取未过期的记录,调用方需持有 mu
+func (backend *memoryBackend) record(key string, now time.Time) (*memoryRecord, bool) {
+	record, ok := backend.records[key]
+	if !ok {
+		return nil, false
+	}
+	if !record.expireAt.IsZero() && !now.Before(record.expireAt) {
+		delete(backend.records, key)
+		return nil, false
+	}
+	return record, true
+}
+
+// 清理过期的记录,调用方需持有 mu
+func (backend *memoryBackend) sweep(now time.Time) {
+	if backend.claims++; backend.claims < sweepEvery {
+		return
+	}
+	backend.claims = 0
+	for key := range backend.records {
+		backend.record(key, now)
+	}
+}
+
+func (backend *memoryBackend) claim(_ context.Context, key, token string, timeout time.Duration) (bool, string, string, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	now := backend.clock.Now()
+	backend.sweep(now)
+	if record, ok := backend.record(key, now); ok {
+		return false, record.state, record.result, nil
+	}
+	backend.records[key] = &memoryRecord{state: stateProcessing, token: token, expireAt: now.Add(timeout)}
+	return true, "", "", nil
+}
+
+func (backend *memoryBackend) complete(_ context.Context, key, token, result string, retention time.Duration) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	now := backend.clock.Now()
+	record, ok := backend.record(key, now)
+	if !ok || record.token != token {
+		return ClaimLostErr
+	}
+	record.state, record.token, record.result = stateDone, "", result
+	record.expireAt = time.Time{}
+	if retention > 0 {
+		record.expireAt = now.Add(retention)
+	}
+	return nil
+}
+
+func (backend *memoryBackend) release(_ context.Context, key, token string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	record, ok := backend.record(key, backend.clock.Now())
+	if !ok || record.token != token {
+		return ClaimLostErr
+	}
+	delete(backend.records, key)
+	return nil
+}
@@ -0,0 +1,108 @@
+/**
+  @author: Zero
+  @date: 2023/7/22 10:48:20
+  @desc: 基于Redis的幂等存储后端
+
+**/
+
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"github.com/zlx2019/sugar/caches"
+	"time"
+)
+
+// 幂等Key以Hash保存: state 状态, token 占用者的身份标识, result 执行结果
+
+// ClaimScript 占用幂等Key
+// KEYS[1]: 幂等Key
+// ARGV[1]: 占用者的身份标识, ARGV[2]: 执行中状态的有效期毫秒数
+// 占用成功返回 {1},否则返回 {0, 状态, 结果}
+const ClaimScript = `
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		redis.call('HSET', KEYS[1], 'state', 'processing', 'token', ARGV[1])
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+		return {1}
+	end
+	local record = redis.call('HMGET', KEYS[1], 'state', 'result')
+	return {0, record[1] or '', record[2] or ''}
+`
+
+// CompleteScript 保存执行结果
+// KEYS[1]: 幂等Key
+// ARGV[1]: 占用者的身份标识, ARGV[2]: 执行结果, ARGV[3]: 保留时长毫秒数,不大于0时永久保留
+const CompleteScript = `
+	if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'state', 'done', 'result', ARGV[2])
+	redis.call('HDEL', KEYS[1], 'token')
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	else
+		redis.call('PERSIST', KEYS[1])
+	end
+	return 1
+`
+
+// ReleaseScript 释放占用
+// KEYS[1]: 幂等Key
+// ARGV[1]: 占用者的身份标识
+const ReleaseScript = `
+	if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then
+		return 0
+	end
+	return redis.call('DEL', KEYS[1])
+`
+
+// 幂等脚本,通过EVALSHA调用
+var (
+	claimScript    = caches.NewScript("sugar_idempotency_claim", ClaimScript)
+	completeScript = caches.NewScript("sugar_idempotency_complete", CompleteScript)
+	releaseScript  = caches.NewScript("sugar_idempotency_release", ReleaseScript)
+)
+
+// Redis存储后端
+type redisBackend struct {
+	template caches.RedisTemplate
+}
+
+func (backend *redisBackend) claim(ctx context.Context, key, token string, timeout time.Duration) (bool, string, string, error) {
+	values, err := backend.template.EvalScript(ctx, claimScript, []string{key}, token, timeout.Milliseconds()).Slice()
+	if err != nil {
+		return false, "", "", err
+	}
+	if len(values) == 1 {
+		return true, "", "", nil
+	}
+	if len(values) != 3 {
+		return false, "", "", fmt.Errorf("idempotency: unexpected script result %v", values)
+	}
+	state, _ := values[1].(string)
+	result, _ := values[2].(string)
+	return false, state, result, nil
+}
+
+func (backend *redisBackend) complete(ctx context.Context, key, token, result string, retention time.Duration) error {
+	n, err := backend.template.EvalScript(ctx, completeScript, []string{key}, token, result, retention.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ClaimLostErr
+	}
+	return nil
+}
+
+func (backend *redisBackend) release(ctx context.Context, key, token string) error {
+	n, err := backend.template.EvalScript(ctx, releaseScript, []string{key}, token).Int64()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return ClaimLostErr
+	}
+	return nil
+}
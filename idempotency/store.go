@@ -0,0 +1,210 @@
+/**
+  @author: Zero
+  @date: 2023/7/22 10:12:36
+  @desc: 幂等Key存储,保证重复的请求只执行一次
+
+**/
+
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/toys/randoms"
+	"time"
+)
+
+var (
+	// InProgressErr 相同Key的请求正在执行中
+	InProgressErr = errors.New("idempotency: request is in progress")
+	// ClaimLostErr 占用已经失效(执行超时后被其他请求占用,或者已经完成、释放),无法再保存结果
+	ClaimLostErr = errors.New("idempotency: claim is no longer held")
+	// EmptyKeyErr 幂等Key为空
+	EmptyKeyErr = errors.New("idempotency: key can't be empty")
+	// InvalidOptionErr 选项不合法,有效期以毫秒为单位保存,不能小于1毫秒
+	InvalidOptionErr = errors.New("idempotency: invalid option")
+)
+
+// 幂等Key的状态
+const (
+	// 执行中
+	stateProcessing = "processing"
+	// 已完成,保存了执行结果
+	stateDone = "done"
+)
+
+// 存储后端,所有操作都需要保证原子性
+type backend interface {
+	// 占用Key,Key不存在时占用成功并标记为执行中;否则返回已有的状态以及结果
+	claim(ctx context.Context, key, token string, timeout time.Duration) (claimed bool, state, result string, err error)
+	// 保存执行结果并将Key标记为已完成,token不匹配时返回 ClaimLostErr
+	complete(ctx context.Context, key, token, result string, retention time.Duration) error
+	// 释放占用,允许重新执行,token不匹配时返回 ClaimLostErr
+	release(ctx context.Context, key, token string) error
+}
+
+// Option 幂等存储选项
+type Option func(options *options)
+
+type options struct {
+	// 存储Key的前缀
+	prefix string
+	// 执行中状态的有效期,超过该时长仍未完成视为执行者已崩溃,允许其他请求重新占用
+	timeout time.Duration
+	// 执行结果的保留时长
+	retention time.Duration
+	// 时钟,仅用于进程内存储
+	clock clock.Clock
+}
+
+// WithPrefix 设置存储Key的前缀,默认为`idempotency:`
+func WithPrefix(prefix string) Option {
+	return func(options *options) {
+		options.prefix = prefix
+	}
+}
+
+// WithTimeout 设置执行中状态的有效期,默认为30秒,不能小于1毫秒
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.timeout = timeout
+	}
+}
+
+// WithRetention 设置执行结果的保留时长,默认为24小时,不大于0时永久保留,大于0时不能小于1毫秒
+func WithRetention(retention time.Duration) Option {
+	return func(options *options) {
+		options.retention = retention
+	}
+}
+
+// WithClock 设置进程内存储使用的时钟,测试时可以注入 clock.Fake
+func WithClock(c clock.Clock) Option {
+	return func(options *options) {
+		options.clock = c
+	}
+}
+
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		prefix:    "idempotency:",
+		timeout:   time.Second * 30,
+		retention: time.Hour * 24,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// 小于1毫秒的有效期会被截断为0,Redis会将其视为立即过期或者永久保留
+	if o.timeout < time.Millisecond {
+		return o, fmt.Errorf("%w: timeout %v is less than 1ms", InvalidOptionErr, o.timeout)
+	}
+	if o.retention > 0 && o.retention < time.Millisecond {
+		return o, fmt.Errorf("%w: retention %v is less than 1ms", InvalidOptionErr, o.retention)
+	}
+	o.clock = clock.OrReal(o.clock)
+	return o, nil
+}
+
+// Store 幂等Key存储
+type Store struct {
+	options
+	backend backend
+}
+
+// NewRedisStore 创建一个基于Redis的幂等存储
+func NewRedisStore(template caches.RedisTemplate, opts ...Option) (*Store, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{options: o, backend: &redisBackend{template: template}}, nil
+}
+
+// NewMemoryStore 创建一个进程内的幂等存储,适用于单实例部署以及单元测试
+func NewMemoryStore(opts ...Option) (*Store, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{options: o, backend: newMemoryBackend(o.clock)}, nil
+}
+
+// Claim 原子性地占用一个幂等Key
+// 占用成功时返回 Claim,执行完成后必须调用 Claim.Complete 保存结果或者 Claim.Release 释放;
+// Key已经完成时返回保存的结果;Key正在执行中时返回 InProgressErr
+func (store *Store) Claim(ctx context.Context, key string) (*Claim, *caches.Reply, error) {
+	if key == "" {
+		return nil, nil, EmptyKeyErr
+	}
+	token := randoms.RandomString(16)
+	claimed, state, result, err := store.backend.claim(ctx, store.prefix+key, token, store.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claimed {
+		return &Claim{store: store, key: key, token: token}, nil, nil
+	}
+	if state == stateDone {
+		return nil, caches.NewReply(redis.NewStringResult(result, nil)), nil
+	}
+	return nil, nil, InProgressErr
+}
+
+// Claim 对一个幂等Key的占用
+type Claim struct {
+	store *Store
+	// 幂等Key
+	key string
+	// 占用者的身份标识
+	token string
+}
+
+// Key 幂等Key
+func (claim *Claim) Key() string {
+	return claim.key
+}
+
+// Complete 保存执行结果并将Key标记为已完成,结果通过 caches.EncodeValue 编码,与 CacheTemplate.SetExpire 写入的内容一致
+// 之后相同Key的请求都将得到该结果,直到保留时长结束
+func (claim *Claim) Complete(ctx context.Context, result any) error {
+	body, err := caches.EncodeValue(result)
+	if err != nil {
+		return err
+	}
+	return claim.store.backend.complete(ctx, claim.store.prefix+claim.key, claim.token, body, claim.store.retention)
+}
+
+// Release 释放占用而不保存结果,通常用于执行失败后允许请求重试
+func (claim *Claim) Release(ctx context.Context) error {
+	return claim.store.backend.release(ctx, claim.store.prefix+claim.key, claim.token)
+}
+
+// Do 以幂等的方式执行fn
+// 首次请求执行fn并保存结果,重复的请求直接返回保存的结果,不会再次执行;
+// fn返回错误时释放占用并返回该错误,结果不会被保存;相同Key的请求正在执行中时返回 InProgressErr
+func (store *Store) Do(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (*caches.Reply, error) {
+	claim, reply, err := store.Claim(ctx, key)
+	if err != nil || reply != nil {
+		return reply, err
+	}
+	result, err := fn(ctx)
+	if err != nil {
+		if releaseErr := claim.Release(ctx); releaseErr != nil {
+			return nil, errors.Join(err, releaseErr)
+		}
+		return nil, err
+	}
+	body, err := caches.EncodeValue(result)
+	if err != nil {
+		_ = claim.Release(ctx)
+		return nil, err
+	}
+	if err = store.backend.complete(ctx, store.prefix+key, claim.token, body, store.retention); err != nil {
+		return nil, err
+	}
+	return caches.NewReply(redis.NewStringResult(body, nil)), nil
+}
@@ -0,0 +1,249 @@
+/**
+  @author: Zero
+  @date: 2023/7/22 14:20:51
+  @desc: 幂等存储单元测试
+
+**/
+
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/idempotency"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+type Payment struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+}
+
+// 对每个后端运行测试
+func run(t *testing.T, test func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store)) {
+	t.Run("Memory", func(t *testing.T) {
+		test(t, func(opts ...idempotency.Option) *idempotency.Store {
+			store, err := idempotency.NewMemoryStore(opts...)
+			assert.NoError(t, err)
+			return store
+		})
+	})
+	t.Run("Redis", func(t *testing.T) {
+		template := redisfake.New(t)
+		test(t, func(opts ...idempotency.Option) *idempotency.Store {
+			store, err := idempotency.NewRedisStore(template, opts...)
+			assert.NoError(t, err)
+			return store
+		})
+	})
+}
+
+// 测试占用、执行中的重复请求以及完成后返回保存的结果
+func TestStore_Claim(t *testing.T) {
+	run(t, func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store) {
+		is := assert.New(t)
+		ctx := context.Background()
+		store := newStore()
+
+		claim, reply, err := store.Claim(ctx, "pay:1")
+		is.NoError(err)
+		is.Nil(reply)
+		is.NotNil(claim)
+		is.Equal("pay:1", claim.Key())
+
+		_, _, err = store.Claim(ctx, "pay:1")
+		is.ErrorIs(err, idempotency.InProgressErr)
+
+		is.NoError(claim.Complete(ctx, Payment{ID: "pay:1", Amount: 100}))
+		is.ErrorIs(claim.Complete(ctx, Payment{}), idempotency.ClaimLostErr)
+
+		again, reply, err := store.Claim(ctx, "pay:1")
+		is.NoError(err)
+		is.Nil(again)
+		var payment Payment
+		is.NoError(reply.ToAny(&payment))
+		is.Equal(int64(100), payment.Amount)
+
+		_, _, err = store.Claim(ctx, "")
+		is.ErrorIs(err, idempotency.EmptyKeyErr)
+	})
+}
+
+// 测试释放占用后允许重新执行
+func TestStore_Release(t *testing.T) {
+	run(t, func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store) {
+		is := assert.New(t)
+		ctx := context.Background()
+		store := newStore()
+
+		claim, _, err := store.Claim(ctx, "pay:2")
+		is.NoError(err)
+		is.NoError(claim.Release(ctx))
+		is.ErrorIs(claim.Release(ctx), idempotency.ClaimLostErr)
+		is.ErrorIs(claim.Complete(ctx, "ok"), idempotency.ClaimLostErr)
+
+		claim, _, err = store.Claim(ctx, "pay:2")
+		is.NoError(err)
+		is.NotNil(claim)
+	})
+}
+
+// 测试并发的重复请求只执行一次
+func TestStore_Do(t *testing.T) {
+	run(t, func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store) {
+		is := assert.New(t)
+		ctx := context.Background()
+		store := newStore()
+		var executed atomic.Int32
+		started := make(chan struct{})
+		finish := make(chan struct{})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := store.Do(ctx, "pay:3", func(ctx context.Context) (any, error) {
+				executed.Add(1)
+				close(started)
+				<-finish
+				return "paid", nil
+			})
+			is.NoError(err)
+			is.Equal("paid", reply.GetString())
+		}()
+		<-started
+		_, err := store.Do(ctx, "pay:3", func(ctx context.Context) (any, error) {
+			executed.Add(1)
+			return "paid twice", nil
+		})
+		is.ErrorIs(err, idempotency.InProgressErr)
+		close(finish)
+		wg.Wait()
+
+		reply, err := store.Do(ctx, "pay:3", func(ctx context.Context) (any, error) {
+			executed.Add(1)
+			return "paid twice", nil
+		})
+		is.NoError(err)
+		is.Equal("paid", reply.GetString())
+		is.Equal(int32(1), executed.Load())
+
+		// 执行失败时不保存结果,允许重试
+		failed := errors.New("gateway timeout")
+		_, err = store.Do(ctx, "pay:4", func(ctx context.Context) (any, error) {
+			return nil, failed
+		})
+		is.ErrorIs(err, failed)
+		reply, err = store.Do(ctx, "pay:4", func(ctx context.Context) (any, error) {
+			return 42, nil
+		})
+		is.NoError(err)
+		is.Equal("42", reply.GetString())
+	})
+}
+
+// 测试没有返回值的请求,nil结果保存为空字符串
+func TestStore_NilResult(t *testing.T) {
+	run(t, func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store) {
+		is := assert.New(t)
+		ctx := context.Background()
+		store := newStore()
+
+		for i := 0; i < 2; i++ {
+			reply, err := store.Do(ctx, "notify:1", func(ctx context.Context) (any, error) {
+				return nil, nil
+			})
+			is.NoError(err)
+			is.True(reply.Ok())
+			is.Equal("", reply.GetString())
+		}
+
+		claim, _, err := store.Claim(ctx, "notify:2")
+		is.NoError(err)
+		is.NoError(claim.Complete(ctx, nil))
+		_, reply, err := store.Claim(ctx, "notify:2")
+		is.NoError(err)
+		is.Equal("", reply.GetString())
+	})
+}
+
+// 测试保存的结果与 CacheTemplate.SetExpire 的编码一致,time.Time 可以通过 ToAny 还原
+func TestStore_TimeResult(t *testing.T) {
+	run(t, func(t *testing.T, newStore func(opts ...idempotency.Option) *idempotency.Store) {
+		is := assert.New(t)
+		ctx := context.Background()
+		store := newStore()
+		paidAt := time.Date(2023, 7, 22, 14, 20, 51, 500, time.UTC)
+
+		for i := 0; i < 2; i++ {
+			reply, err := store.Do(ctx, "paid-at:1", func(ctx context.Context) (any, error) {
+				return paidAt, nil
+			})
+			is.NoError(err)
+			var got time.Time
+			is.NoError(reply.ToAny(&got))
+			is.True(paidAt.Equal(got))
+		}
+
+		claim, _, err := store.Claim(ctx, "paid-at:2")
+		is.NoError(err)
+		is.NoError(claim.Complete(ctx, paidAt))
+		_, reply, err := store.Claim(ctx, "paid-at:2")
+		is.NoError(err)
+		var got time.Time
+		is.NoError(reply.ToAny(&got))
+		is.True(paidAt.Equal(got))
+	})
+}
+
+// 测试小于1毫秒的有效期被拒绝,不大于0的保留时长表示永久保留
+func TestNewStore_InvalidOption(t *testing.T) {
+	is := assert.New(t)
+	_, err := idempotency.NewMemoryStore(idempotency.WithTimeout(time.Microsecond * 500))
+	is.ErrorIs(err, idempotency.InvalidOptionErr)
+	_, err = idempotency.NewMemoryStore(idempotency.WithTimeout(0))
+	is.ErrorIs(err, idempotency.InvalidOptionErr)
+	_, err = idempotency.NewRedisStore(redisfake.New(t), idempotency.WithRetention(time.Microsecond*500))
+	is.ErrorIs(err, idempotency.InvalidOptionErr)
+	_, err = idempotency.NewMemoryStore(idempotency.WithRetention(0))
+	is.NoError(err)
+	_, err = idempotency.NewMemoryStore(idempotency.WithRetention(-time.Second))
+	is.NoError(err)
+}
+
+// 测试执行超时以及结果的保留时长
+func TestMemoryStore_Expire(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	store, err := idempotency.NewMemoryStore(idempotency.WithClock(fake),
+		idempotency.WithTimeout(time.Second*5), idempotency.WithRetention(time.Minute))
+	is.NoError(err)
+
+	crashed, _, err := store.Claim(ctx, "pay:5")
+	is.NoError(err)
+	fake.Advance(time.Second * 5)
+	// 执行者超时后,其他请求可以重新占用,原占用者无法再保存结果
+	claim, _, err := store.Claim(ctx, "pay:5")
+	is.NoError(err)
+	is.NotNil(claim)
+	is.ErrorIs(crashed.Complete(ctx, "stale"), idempotency.ClaimLostErr)
+	is.NoError(claim.Complete(ctx, "done"))
+
+	fake.Advance(time.Second * 59)
+	_, reply, err := store.Claim(ctx, "pay:5")
+	is.NoError(err)
+	is.Equal("done", reply.GetString())
+	fake.Advance(time.Second)
+	claim, reply, err = store.Claim(ctx, "pay:5")
+	is.NoError(err)
+	is.Nil(reply)
+	is.NotNil(claim)
+}
@@ -0,0 +1,108 @@
+/**
+  @author: Zero
+  @date: 2023/7/17 10:14:02
+  @desc: 用于单元测试的进程内Redis替身
+
+**/
+
+package redisfake
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/clock"
+)
+
+// 替身中的时间随真实时间推进的间隔
+const tick = 10 * time.Millisecond
+
+// New 启动一个进程内的Redis替身,返回连接到该替身的模板,测试结束时自动关闭
+// 替身中Key的有效期随真实时间推进
+func New(t testing.TB) caches.RedisTemplate {
+	server := miniredis.RunT(t)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				server.FastForward(tick)
+			}
+		}
+	}()
+	t.Cleanup(func() { close(done) })
+	return newTemplate(t, server)
+}
+
+// NewWithClock 启动一个进程内的Redis替身,替身中的时间跟随c推进
+// 每条命令执行前将替身的时间同步到c的当前时间,推进 clock.Fake 后Key立即按新的时间过期
+// 返回的模板同样使用c计算到期时刻
+func NewWithClock(t testing.TB, c clock.Clock) caches.RedisTemplate {
+	server := miniredis.RunT(t)
+	server.SetTime(c.Now())
+	template := newTemplate(t, server)
+	template.Client.AddHook(&clockHook{server: server, clock: c, last: c.Now()})
+	template.Clock = c
+	return template
+}
+
+// 创建连接到替身的模板,测试结束时关闭连接
+func newTemplate(t testing.TB, server *miniredis.Miniredis) caches.RedisTemplate {
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return caches.RedisTemplate{
+		Client:  client,
+		Scripts: caches.NewScriptRegistry(),
+	}
+}
+
+// 在命令执行前将替身的时间同步到时钟的当前时间
+type clockHook struct {
+	server *miniredis.Miniredis
+	clock  clock.Clock
+	mu     sync.Mutex
+	// 上次同步时的时间,时钟回拨时不会让Key的有效期倒退
+	last time.Time
+}
+
+// 同步替身的时间
+func (hook *clockHook) sync() {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	now := hook.clock.Now()
+	if elapsed := now.Sub(hook.last); elapsed > 0 {
+		hook.server.FastForward(elapsed)
+		hook.last = now
+	}
+	hook.server.SetTime(now)
+}
+
+func (hook *clockHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (hook *clockHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		hook.sync()
+		return next(ctx, cmd)
+	}
+}
+
+func (hook *clockHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		hook.sync()
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,403 @@
+/**
+  @author: Zero
+  @date: 2023/7/10 09:12:45
+  @desc: 用于单元测试的数据库替身,模拟PostgreSQL咨询锁以及MySQL命名锁
+
+**/
+
+package sqlfake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 等待命名锁时的轮询间隔
+const pollInterval = 5 * time.Millisecond
+
+// Server 模拟数据库服务端的锁状态
+// 支持PostgreSQL的 pg_try_advisory_lock、pg_try_advisory_xact_lock、pg_advisory_unlock
+// 以及MySQL的 GET_LOCK、RELEASE_LOCK,锁按连接(会话)持有并且可重入,连接关闭时释放该连接持有的所有锁
+type Server struct {
+	mu sync.Mutex
+	// PostgreSQL咨询锁
+	advisory map[int64]*holder
+	// MySQL命名锁
+	named map[string]*holder
+	// 所有打开的连接
+	conns map[*conn]struct{}
+}
+
+// 锁的持有者以及重入次数
+type holder struct {
+	owner *conn
+	count int
+}
+
+// New 创建一个数据库替身
+func New() *Server {
+	return &Server{
+		advisory: make(map[int64]*holder),
+		named:    make(map[string]*holder),
+		conns:    make(map[*conn]struct{}),
+	}
+}
+
+// DB 返回连接到该替身的连接池
+func (server *Server) DB() *sql.DB {
+	return sql.OpenDB(connector{server})
+}
+
+// KillAll 断开所有连接,释放所有连接持有的锁,模拟数据库重启或者网络中断
+func (server *Server) KillAll() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for c := range server.conns {
+		c.broken.Store(true)
+		server.releaseAll(c)
+	}
+	server.conns = make(map[*conn]struct{})
+}
+
+// 释放连接持有的所有锁,调用方需持有 mu
+func (server *Server) releaseAll(c *conn) {
+	for key, h := range server.advisory {
+		if h.owner == c {
+			delete(server.advisory, key)
+		}
+	}
+	for name, h := range server.named {
+		if h.owner == c {
+			delete(server.named, name)
+		}
+	}
+}
+
+// 尝试获取咨询锁
+func (server *Server) tryAdvisory(c *conn, key int64) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if h, ok := server.advisory[key]; ok {
+		if h.owner != c {
+			return false
+		}
+		h.count++
+		return true
+	}
+	server.advisory[key] = &holder{owner: c, count: 1}
+	return true
+}
+
+// 释放咨询锁,锁不属于该连接时返回false
+func (server *Server) unlockAdvisory(c *conn, key int64) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	h, ok := server.advisory[key]
+	if !ok || h.owner != c {
+		return false
+	}
+	if h.count--; h.count == 0 {
+		delete(server.advisory, key)
+	}
+	return true
+}
+
+// 尝试获取命名锁
+func (server *Server) tryNamed(c *conn, name string) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if h, ok := server.named[name]; ok {
+		if h.owner != c {
+			return false
+		}
+		h.count++
+		return true
+	}
+	server.named[name] = &holder{owner: c, count: 1}
+	return true
+}
+
+// 获取命名锁,最多等待timeout,timeout为负数时一直等待
+// 获取成功返回1,超时返回0
+func (server *Server) getNamed(ctx context.Context, c *conn, name string, timeout time.Duration) (int64, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if server.tryNamed(c, name) {
+			return 1, nil
+		}
+		if timeout >= 0 && !time.Now().Before(deadline) {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// 释放命名锁,释放成功返回1,锁被其他连接持有返回0,锁不存在返回NULL
+func (server *Server) releaseNamed(c *conn, name string) any {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	h, ok := server.named[name]
+	if !ok {
+		return nil
+	}
+	if h.owner != c {
+		return int64(0)
+	}
+	if h.count--; h.count == 0 {
+		delete(server.named, name)
+	}
+	return int64(1)
+}
+
+// 连接器
+type connector struct {
+	server *Server
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	cn := &conn{server: c.server}
+	c.server.mu.Lock()
+	c.server.conns[cn] = struct{}{}
+	c.server.mu.Unlock()
+	return cn, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// 仅用于满足 driver.Connector 接口
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("sqlfake: use Server.DB")
+}
+
+// 一个数据库连接(会话)
+type conn struct {
+	server *Server
+	// 连接已被服务端断开
+	broken atomic.Bool
+	// 当前事务中获取的咨询锁,事务结束时释放
+	xact []int64
+	// 是否处于事务中
+	inTx bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	c.server.releaseAll(c)
+	delete(c.server.conns, c)
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if c.broken.Load() {
+		return nil, driver.ErrBadConn
+	}
+	c.inTx = true
+	return tx{c}, nil
+}
+
+func (c *conn) Ping(context.Context) error {
+	if c.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(context.Context) error {
+	if c.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.QueryContext(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// QueryContext 根据语句中的函数名模拟执行
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.broken.Load() {
+		return nil, driver.ErrBadConn
+	}
+	var value any
+	switch q := strings.ToLower(query); {
+	case strings.Contains(q, "pg_try_advisory_xact_lock("):
+		key, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value = c.server.tryAdvisory(c, key)
+		if value == true {
+			if c.inTx {
+				c.xact = append(c.xact, key)
+			} else {
+				// 事务外执行时,语句结束即释放
+				c.server.unlockAdvisory(c, key)
+			}
+		}
+	case strings.Contains(q, "pg_try_advisory_lock("):
+		key, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value = c.server.tryAdvisory(c, key)
+	case strings.Contains(q, "pg_advisory_unlock("):
+		key, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value = c.server.unlockAdvisory(c, key)
+	case strings.Contains(q, "get_lock("):
+		name, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := intArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = c.server.getNamed(ctx, c, name, time.Duration(seconds)*time.Second); err != nil {
+			return nil, err
+		}
+	case strings.Contains(q, "release_lock("):
+		name, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		value = c.server.releaseNamed(c, name)
+	case strings.TrimSpace(q) == "select 1":
+		value = int64(1)
+	default:
+		return nil, fmt.Errorf("sqlfake: unsupported query %q", query)
+	}
+	return &rows{value: value}, nil
+}
+
+// 获取整数类型的参数
+func intArg(args []driver.NamedValue, i int) (int64, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("sqlfake: missing argument %d", i+1)
+	}
+	v, ok := args[i].Value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("sqlfake: argument %d is %T, want int64", i+1, args[i].Value)
+	}
+	return v, nil
+}
+
+// 获取字符串类型的参数
+func stringArg(args []driver.NamedValue, i int) (string, error) {
+	if i >= len(args) {
+		return "", fmt.Errorf("sqlfake: missing argument %d", i+1)
+	}
+	v, ok := args[i].Value.(string)
+	if !ok {
+		return "", fmt.Errorf("sqlfake: argument %d is %T, want string", i+1, args[i].Value)
+	}
+	return v, nil
+}
+
+// 事务,结束时释放事务中获取的咨询锁
+type tx struct {
+	conn *conn
+}
+
+func (t tx) Commit() error {
+	return t.end()
+}
+
+func (t tx) Rollback() error {
+	return t.end()
+}
+
+func (t tx) end() error {
+	for _, key := range t.conn.xact {
+		t.conn.server.unlockAdvisory(t.conn, key)
+	}
+	t.conn.xact = nil
+	t.conn.inTx = false
+	if t.conn.broken.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// 预编译语句,直接交由连接执行
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+// 只有一行一列的结果集
+type rows struct {
+	value any
+	done  bool
+}
+
+func (r *rows) Columns() []string {
+	return []string{"result"}
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
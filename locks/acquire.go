@@ -0,0 +1,134 @@
+/**
+  @author: Zero
+  @date: 2023/6/20 10:48:31
+  @desc: 各类锁实现共用的加锁、释放锁流程
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zlx2019/sugar/caches"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 加锁流程: 链路追踪、指标采集、阻塞模式下的自旋重试
+// 加锁成功后开启持有锁期间的Span,启用看门狗时启动续约任务
+func (options *LockOptions) acquire(ctx context.Context, target renewable, try func(ctx context.Context) error) (err error) {
+	// 加锁指标采集
+	start := options.clock.Now()
+	attempts := 1
+	// 加锁链路追踪
+	acquireCtx, span := options.tracer.Start(ctx, "lock.Acquire", trace.WithAttributes(
+		attrLockNamespace.String(caches.KeyNamespace(target.name())), attrLockBlocking.Bool(options.blocking)))
+	defer func() {
+		options.metrics.ObserveLockAcquire(acquireResult(err), attempts, options.clock.Since(start))
+		endAcquireSpan(span, attempts, err)
+		if err != nil {
+			return
+		}
+		// 持有锁期间的Span,释放锁时结束
+		ctx, options.holdSpan = options.tracer.Start(ctx, "lock.Hold", trace.WithAttributes(
+			attrLockNamespace.String(caches.KeyNamespace(target.name()))))
+		// 获取锁后,如果开启了看门狗则初始化看门狗状态等
+		if options.enabled {
+			options.doWatchDog(ctx, target)
+		}
+	}()
+
+	// 记录成功的那次加锁尝试的开始时刻,锁的实际过期时刻不会早于该时刻加上有效时长
+	attempt := try
+	try = func(ctx context.Context) error {
+		begin := options.clock.Now()
+		if err := attempt(ctx); err != nil {
+			return err
+		}
+		options.expiresAt = begin.Add(options.expire)
+		return nil
+	}
+
+	// 无论阻塞与非阻塞模式,都要先加一次锁
+	err = try(acquireCtx)
+	if err == nil {
+		// 加锁成功
+		return nil
+	}
+	// ======加锁失败处理=======
+
+	// 非阻塞模式直接返回error
+	// 由服务端阻塞等待的实现(例如MySQL GET_LOCK)等待超时后也不再重试
+	if !options.blocking || errors.Is(err, LockBlockingTimeOutErr) {
+		return err
+	}
+	// 阻塞模式继续尝试加锁(自旋+重试)
+	retries, err := options.loopTryLock(acquireCtx, try)
+	attempts += retries
+	return err
+}
+
+// 循环尝试加锁,直到阻塞时长用尽、可重试次数用尽、context中断。
+// 返回本次循环中尝试加锁的次数
+func (options *LockOptions) loopTryLock(ctx context.Context, try func(ctx context.Context) error) (attempts int, err error) {
+	// 超时通知器  如果超过锁的 `blockingTime`时长还未抢抢到锁,则表示获取锁超时
+	timeOutChan := options.clock.After(options.blockingTime)
+	// 轮询定时器 每隔锁的`retryWaitingTime`时长尝试加锁一次,直到`retry`次数用尽
+	loopTicker := options.clock.NewTicker(options.retryWaitingTime)
+	defer loopTicker.Stop()
+	// 本次加锁剩余的重试次数
+	retry := options.retry
+
+	// 开始循环获取锁
+	for range loopTicker.C() {
+		select {
+		case <-ctx.Done():
+			// 整个上下文终止
+			return attempts, fmt.Errorf("lock failed ctx timeout, err: %w", ctx.Err())
+		case <-timeOutChan:
+			// 阻塞等待到达上限时间
+			return attempts, LockBlockingTimeOutErr
+		default:
+			//放行,继续尝试加锁
+		}
+		attempts++
+		err := try(ctx)
+		if err == nil {
+			// 加锁成功
+			return attempts, nil
+		}
+		// 递减可重试次数
+		if retry -= 1; retry <= 0 {
+			// 已经没有可重试的次数
+			return attempts, LockNotRetryErr
+		}
+	}
+	// 不可达
+	return attempts, nil
+}
+
+// 释放锁流程: 链路追踪、停止看门狗以及结束持有锁期间的Span
+func (options *LockOptions) release(ctx context.Context, target renewable, unlock func(ctx context.Context) error) (err error) {
+	// 释放锁链路追踪
+	ctx, span := options.tracer.Start(ctx, "lock.Release", trace.WithAttributes(
+		attrLockNamespace.String(caches.KeyNamespace(target.name()))))
+	defer func() {
+		endReleaseSpan(span, err)
+		// 结束持有锁期间的Span
+		if options.holdSpan != nil {
+			options.holdSpan.End()
+			options.holdSpan = nil
+		}
+	}()
+	// 看门狗处理
+	defer func() {
+		// 解锁失败或者没有开启看门狗 不作处理
+		if err != nil || !options.enabled {
+			return
+		}
+		// 停止看门狗
+		options.stopWatchDog()
+	}()
+	return unlock(ctx)
+}
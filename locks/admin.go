@@ -0,0 +1,166 @@
+/**
+  @author: Zero
+  @date: 2023/7/2 10:30:42
+  @desc: Redis分布式锁的查询与管理
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/zlx2019/sugar/caches"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 持有信息Key的后缀
+	ownerKeySuffix = ":owner"
+	// 加锁计数Key的后缀
+	fenceKeySuffix = ":fence"
+	// 每次SCAN的数量
+	scanCount = 100
+)
+
+// OwnerKey 返回锁的持有信息Key,与锁的有效期一致
+func OwnerKey(key string) string {
+	return key + ownerKeySuffix
+}
+
+// FenceKey 返回锁的加锁计数Key,启用 WithFencing 时使用,永久保存
+func FenceKey(key string) string {
+	return key + fenceKeySuffix
+}
+
+// 是否为Key类型错误,锁的Key都是string类型
+func isWrongType(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "WRONGTYPE")
+}
+
+// LockInfo 锁的持有信息
+type LockInfo struct {
+	// 锁的Key
+	Key string
+	// 持有者的身份标识
+	Token string
+	// 加锁时间,未记录时为零值
+	AcquiredAt time.Time
+	// 剩余有效期
+	TTL time.Duration
+	// 加锁计数,即该锁第几次被获取,未启用 WithFencing 时为0
+	Fence int64
+	// 持有者的主机名,未启用 WithOwnerMetadata 时为空
+	Hostname string
+	// 持有者的进程ID,未启用 WithOwnerMetadata 时为0
+	PID int
+	// 持有者的服务名称,未启用 WithOwnerMetadata 时为空
+	Service string
+}
+
+// Admin Redis分布式锁的管理接口,用于排查问题时查询、强制释放锁
+type Admin struct {
+	// Redis客户端
+	template caches.RedisTemplate
+}
+
+// NewAdmin 创建一个锁管理接口
+func NewAdmin(template caches.RedisTemplate) *Admin {
+	return &Admin{template: template}
+}
+
+// List 列出所有匹配pattern的锁
+// 加锁时总会写入持有信息,因此只扫描匹配pattern的 OwnerKey,并且只返回持有信息属于当前持有者的锁
+func (admin *Admin) List(ctx context.Context, pattern string) ([]LockInfo, error) {
+	var infos []LockInfo
+	var cursor uint64
+	for {
+		keys, next, err := admin.template.Client.Scan(ctx, cursor, OwnerKey(pattern), scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, ownerKey := range keys {
+			info, owned, err := admin.lookup(ctx, strings.TrimSuffix(ownerKey, ownerKeySuffix))
+			if errors.Is(err, LockNotHeldErr) || isWrongType(err) || (err == nil && !owned) {
+				// 扫描期间锁已被释放,或者不是锁
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, *info)
+		}
+		if cursor = next; cursor == 0 {
+			return infos, nil
+		}
+	}
+}
+
+// Get 查询一把锁的持有信息,锁没有被持有时返回 LockNotHeldErr
+func (admin *Admin) Get(ctx context.Context, key string) (*LockInfo, error) {
+	info, _, err := admin.lookup(ctx, key)
+	return info, err
+}
+
+// 查询一把锁的持有信息,owned 表示持有信息是否属于当前持有者
+func (admin *Admin) lookup(ctx context.Context, key string) (info *LockInfo, owned bool, err error) {
+	pipe := admin.template.Client.Pipeline()
+	tokenCmd := pipe.Get(ctx, key)
+	ttlCmd := pipe.PTTL(ctx, key)
+	ownerCmd := pipe.HGetAll(ctx, OwnerKey(key))
+	_, err = pipe.Exec(ctx)
+	if errors.Is(tokenCmd.Err(), redis.Nil) {
+		return nil, false, LockNotHeldErr
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	info = &LockInfo{
+		Key:   key,
+		Token: tokenCmd.Val(),
+		TTL:   ttlCmd.Val(),
+	}
+	owner := ownerCmd.Val()
+	// 持有信息属于当前持有者时才使用
+	if owned = owner["token"] == info.Token; owned {
+		if ms, err := strconv.ParseInt(owner["acquired_at"], 10, 64); err == nil {
+			info.AcquiredAt = time.UnixMilli(ms)
+		}
+		info.Fence, _ = strconv.ParseInt(owner["fence"], 10, 64)
+		info.Hostname = owner[ownerFieldHostname]
+		info.PID, _ = strconv.Atoi(owner[ownerFieldPID])
+		info.Service = owner[ownerFieldService]
+	}
+	return info, owned, nil
+}
+
+// ForceRelease 强制释放一把锁,不校验持有者身份
+func (admin *Admin) ForceRelease(ctx context.Context, key string) error {
+	n, err := admin.template.Client.Del(ctx, key, OwnerKey(key)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return LockNotHeldErr
+	}
+	return nil
+}
+
+// ForceExpire 强制将一把锁的剩余有效期设置为ttl,不校验持有者身份
+// 持有者的看门狗可能会再次续约,如需立即释放请使用 ForceRelease
+func (admin *Admin) ForceExpire(ctx context.Context, key string, ttl time.Duration) error {
+	pipe := admin.template.Client.Pipeline()
+	keyCmd := pipe.PExpire(ctx, key, ttl)
+	pipe.PExpire(ctx, OwnerKey(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if !keyCmd.Val() {
+		return LockNotHeldErr
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/**
+  @author: Zero
+  @date: 2023/7/2 15:20:36
+  @desc: Redis分布式锁管理单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+// 测试查询锁的持有信息
+func TestAdmin_Get(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	admin := NewAdmin(template)
+	lock := NewRedisDistributedLock("admin:order-1", template, WithExpire(time.Second*10), WithFencing())
+	is.NoError(lock.Lock(context.Background()))
+
+	info, err := admin.Get(context.Background(), "admin:order-1")
+	is.NoError(err)
+	is.Equal(lock.token, info.Token)
+	is.Equal(lock.Fence(), info.Fence)
+	is.WithinDuration(time.Now(), info.AcquiredAt, time.Second)
+	is.InDelta(time.Second*10, info.TTL, float64(time.Second))
+
+	// 每次加锁计数都会递增
+	is.NoError(lock.Unlock(context.Background()))
+	fence := lock.Fence()
+	is.NoError(lock.Lock(context.Background()))
+	is.Equal(fence+1, lock.Fence())
+	is.NoError(lock.Unlock(context.Background()))
+	_, err = admin.Get(context.Background(), "admin:order-1")
+	is.ErrorIs(err, LockNotHeldErr)
+	is.False(template.Exists(OwnerKey("admin:order-1")))
+
+	// 未启用 WithFencing 时不维护加锁计数
+	plain := NewRedisDistributedLock("admin:order-2", template, WithExpire(time.Second*10))
+	is.NoError(plain.Lock(context.Background()))
+	is.Zero(plain.Fence())
+	is.False(template.Exists(FenceKey("admin:order-2")))
+	info, err = admin.Get(context.Background(), "admin:order-2")
+	is.NoError(err)
+	is.Equal(plain.token, info.Token)
+	is.Zero(info.Fence)
+}
+
+// 测试列出锁以及强制释放、强制过期
+func TestAdmin_Force(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	admin := NewAdmin(template)
+	lock1 := NewRedisDistributedLock("admin-force:1", template, WithExpire(time.Second*10))
+	lock2 := NewRedisDistributedLock("admin-force:2", template, WithExpire(time.Second*10))
+	is.NoError(lock1.Lock(context.Background()))
+	is.NoError(lock2.Lock(context.Background()))
+
+	// 名称以 :owner 结尾的锁,以及多Key锁的每个Key都会被列出,普通Key不会
+	lock3 := NewRedisDistributedLock("admin-force:owner", template, WithExpire(time.Second*10))
+	is.NoError(lock3.Lock(context.Background()))
+	multi, err := NewRedisMultiLock([]string{"admin-force:a", "admin-force:b"}, template, WithExpire(time.Second*10))
+	is.NoError(err)
+	is.NoError(multi.Lock(context.Background()))
+	is.NoError(template.Set("admin-force:plain", "value"))
+
+	infos, err := admin.List(context.Background(), "admin-force:*")
+	is.NoError(err)
+	keys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	is.ElementsMatch([]string{"admin-force:1", "admin-force:2", "admin-force:owner", "admin-force:a", "admin-force:b"}, keys)
+
+	is.NoError(admin.ForceRelease(context.Background(), "admin-force:1"))
+	is.ErrorIs(lock1.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+	is.ErrorIs(admin.ForceRelease(context.Background(), "admin-force:1"), LockNotHeldErr)
+
+	is.NoError(admin.ForceExpire(context.Background(), "admin-force:2", time.Second))
+	info, err := admin.Get(context.Background(), "admin-force:2")
+	is.NoError(err)
+	is.LessOrEqual(info.TTL, time.Second)
+	is.ErrorIs(admin.ForceExpire(context.Background(), "admin-force:1", time.Second), LockNotHeldErr)
+}
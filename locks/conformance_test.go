@@ -0,0 +1,73 @@
+/**
+  @author: Zero
+  @date: 2023/7/17 14:25:50
+  @desc: 对所有锁实现运行一致性测试
+
+**/
+
+package locks_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zlx2019/sugar/internal/redisfake"
+	"github.com/zlx2019/sugar/internal/sqlfake"
+	"github.com/zlx2019/sugar/locks"
+	"github.com/zlx2019/sugar/locks/lockstest"
+)
+
+func TestConformance_Redis(t *testing.T) {
+	t.Parallel()
+	template := redisfake.New(t)
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locks.NewRedisDistributedLock(key, template, opts...)
+	})
+}
+
+func TestConformance_RedisMulti(t *testing.T) {
+	t.Parallel()
+	template := redisfake.New(t)
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		lock, err := locks.NewRedisMultiLock([]string{key + ":a", key + ":b"}, template, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lock
+	})
+}
+
+func TestConformance_Postgres(t *testing.T) {
+	t.Parallel()
+	db := sqlfake.New().DB()
+	t.Cleanup(func() { _ = db.Close() })
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locks.NewPostgresLock(key, db, opts...)
+	}, lockstest.WithoutExpiry())
+}
+
+func TestConformance_MySQL(t *testing.T) {
+	t.Parallel()
+	db := sqlfake.New().DB()
+	t.Cleanup(func() { _ = db.Close() })
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locks.NewMySQLLock(key, db, opts...)
+	}, lockstest.WithoutExpiry(), lockstest.WithServerSideBlocking())
+}
+
+func TestConformance_File(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locks.NewFileLock(filepath.Join(dir, strings.NewReplacer("/", "_", ":", "_").Replace(key)), opts...)
+	}, lockstest.WithoutExpiry())
+}
+
+func TestConformance_Memory(t *testing.T) {
+	t.Parallel()
+	locker := locks.NewMemoryLocker()
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locker.NewLock(key, opts...)
+	})
+}
@@ -0,0 +1,66 @@
+/**
+  @author: Zero
+  @date: 2023/6/25 11:05:16
+  @desc: 在锁的保护下执行函数
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"github.com/zlx2019/sugar/clock"
+	"time"
+)
+
+// 有有效期的锁,没有看门狗续约时到达过期时刻后会被自动释放
+type expiring interface {
+	// 本次持有锁的过期时刻以及计时使用的时钟
+	expiry() (time.Time, clock.Clock)
+}
+
+// Do 获取锁后执行fn,执行结束后释放锁
+// fn的上下文会在锁丢失或者到达最长持有时长时被取消,可通过 context.Cause 获取原因
+// 没有启用看门狗的锁到达有效期时,fn的上下文以 LockExpiredErr 取消
+// 无论fn返回错误还是发生panic,锁都会被释放,释放锁的错误会与fn的错误合并返回
+func Do(ctx context.Context, lock DistributedLock, fn func(ctx context.Context) error) (err error) {
+	if err = lock.Lock(ctx); err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var lost <-chan struct{}
+	notifier, ok := lock.(LostNotifier)
+	if ok {
+		lost = notifier.Lost()
+	}
+	if lost != nil {
+		// 监听锁丢失
+		go func() {
+			select {
+			case <-lost:
+				cancel(notifier.LostErr())
+			case <-runCtx.Done():
+			}
+		}()
+	} else if target, ok := lock.(expiring); ok {
+		// 没有看门狗续约,到达过期时刻后锁可能已被他人持有
+		expiresAt, clk := target.expiry()
+		timer := clk.NewTimer(clk.Until(expiresAt))
+		go func() {
+			defer timer.Stop()
+			select {
+			case <-timer.C():
+				cancel(LockExpiredErr)
+			case <-runCtx.Done():
+			}
+		}()
+	}
+	defer func() {
+		// 调用方的上下文可能已被取消,释放锁时不受其影响
+		unlockErr := lock.Unlock(context.WithoutCancel(ctx))
+		err = errors.Join(err, unlockErr)
+	}()
+	return fn(runCtx)
+}
@@ -0,0 +1,91 @@
+/**
+  @author: Zero
+  @date: 2023/6/25 11:40:27
+  @desc: 在锁的保护下执行函数单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+// 测试执行完成后释放锁,并合并释放锁的错误
+func TestDo(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	lock := NewRedisDistributedLock("do:lock-key", template, WithExpire(time.Second*5))
+	is.NoError(Do(context.Background(), lock, func(ctx context.Context) error {
+		is.True(template.Exists("do:lock-key"))
+		return nil
+	}))
+	is.False(template.Exists("do:lock-key"))
+
+	// 执行期间锁被删除,返回fn错误与释放锁错误的合并
+	fnErr := errors.New("fn failed")
+	err := Do(context.Background(), lock, func(ctx context.Context) error {
+		is.NoError(template.Del("do:lock-key"))
+		return fnErr
+	})
+	is.ErrorIs(err, fnErr)
+	is.ErrorIs(err, UnlockWithoutOwnershipErr)
+}
+
+// 测试发生panic时仍然释放锁
+func TestDo_Panic(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	lock := NewRedisDistributedLock("do:panic-key", template, WithExpire(time.Second*5))
+	is.Panics(func() {
+		_ = Do(context.Background(), lock, func(ctx context.Context) error {
+			panic("boom")
+		})
+	})
+	is.False(template.Exists("do:panic-key"))
+}
+
+// 测试到达最长持有时长时取消fn的上下文
+func TestDo_MaxHold(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	lock := NewRedisDistributedLock("do:hold-key", redisfake.New(t), WithExpire(time.Second),
+		WithWatchDog(), WithMaxHold(time.Millisecond*500))
+	err := Do(context.Background(), lock, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(time.Second * 3):
+			return nil
+		}
+	})
+	is.ErrorIs(err, LockMaxHoldErr)
+}
+
+// 测试没有看门狗的锁到达有效期时取消fn的上下文
+func TestDo_Expired(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	fake := clock.NewFake(time.Now())
+	locker := NewMemoryLocker()
+	locker.Clock = fake
+	lock := locker.NewLock("do:expire-key", WithExpire(time.Second))
+	err := Do(context.Background(), lock, func(ctx context.Context) error {
+		fake.BlockUntil(1)
+		fake.Advance(time.Second)
+		<-ctx.Done()
+		return context.Cause(ctx)
+	})
+	is.ErrorIs(err, LockExpiredErr)
+	// 锁已过期,释放锁失败
+	is.ErrorIs(err, UnlockWithoutOwnershipErr)
+}
@@ -12,11 +12,23 @@ import "errors"
 var (
 	// LockBlockingTimeOutErr 阻塞模式获取锁超时错误
 	LockBlockingTimeOutErr = errors.New("lock failed blocking timeout")
+	// LockAlreadyHeldErr 锁已被他人持有,加锁失败
+	LockAlreadyHeldErr = errors.New("lock failed already held by others")
 	// LockNotRetryErr 阻塞模式自旋重试加锁次数已用尽错误
 	LockNotRetryErr = errors.New("lock failed retry used up")
+	// LockEmptyKeysErr 多Key锁的Key列表为空
+	LockEmptyKeysErr = errors.New("lock failed empty keys")
 
 	// UnlockWithoutOwnershipErr 释放一把对自己无所有权的锁从而产生的错误
 	UnlockWithoutOwnershipErr = errors.New("unlock failed without ownership")
 	// DelayLockWithoutOwnershipErr 对一个没有所有权的锁续约从而产生的错误
 	DelayLockWithoutOwnershipErr = errors.New("delay lock failed without ownership")
+	// LockLostErr 看门狗续约失败,锁已丢失
+	LockLostErr = errors.New("lock lost")
+	// LockNotHeldErr 锁当前没有被持有
+	LockNotHeldErr = errors.New("lock not held")
+	// LockMaxHoldErr 锁已到达最长持有时长,看门狗停止续约
+	LockMaxHoldErr = errors.New("lock max hold time reached")
+	// LockExpiredErr 锁已到达有效期,可能已被他人持有
+	LockExpiredErr = errors.New("lock expired")
 )
\ No newline at end of file
@@ -0,0 +1,225 @@
+/**
+  @author: Zero
+  @date: 2023/7/12 09:31:52
+  @desc: 基于文件锁(flock)的单机锁实现
+
+**/
+
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileLock 基于flock的单机锁,适用于命令行工具以及单机批处理任务之间的协调
+// 加锁时对锁文件加排他的建议锁,并将持有者信息写入锁文件,进程退出时由操作系统自动释放
+// 只要锁文件仍被加锁(例如文件描述符泄漏到了子进程)就视为已被持有,不会删除可能被他人持有的锁文件;
+// 锁文件中残留的失效持有者信息在加锁成功后直接覆盖
+//
+// 文件锁没有有效期,WithExpire 仅用于计算看门狗的检查间隔;
+// 启用看门狗时定期检查锁文件是否仍为自己持有的文件,被删除或替换时通过 Lost 通知持有者
+type FileLock struct {
+	// 锁的功能配置
+	LockOptions
+	// 锁文件路径
+	path string
+	// 锁的身份标识,写入锁文件
+	token string
+	// 保护持有状态,看门狗会并发访问
+	mu sync.Mutex
+	// 持有锁的文件
+	file *os.File
+}
+
+// 锁文件中记录的持有者信息
+type fileOwner struct {
+	Token      string    `json:"token"`
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	Service    string    `json:"service,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// NewFileLock 创建一个文件锁,path为锁文件路径,不存在时自动创建
+func NewFileLock(path string, opts ...LockOption) *FileLock {
+	lock := FileLock{path: path}
+	// 设置锁的配置选项
+	for _, opt := range opts {
+		opt(&lock.LockOptions)
+	}
+	// 检查选项,填补默认参数
+	optionWithDefault(&lock.LockOptions)
+	lock.token = lock.tokenGenerator()
+	return &lock
+}
+
+// ReadFileLockInfo 读取锁文件中记录的持有者信息,锁文件不存在或者未被持有时返回 LockNotHeldErr
+// 通过非阻塞的共享锁探测锁文件是否仍被加锁,持有进程崩溃后残留的持有者信息同样返回 LockNotHeldErr
+func ReadFileLockInfo(path string) (LockInfo, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return LockInfo{}, LockNotHeldErr
+	}
+	if err != nil {
+		return LockInfo{}, err
+	}
+	defer file.Close()
+	held, err := flocked(file)
+	if err != nil {
+		return LockInfo{}, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return LockInfo{}, err
+	}
+	if len(data) == 0 {
+		return LockInfo{}, LockNotHeldErr
+	}
+	var owner fileOwner
+	if err = json.Unmarshal(data, &owner); err != nil {
+		return LockInfo{}, fmt.Errorf("decode lock file %s: %w", path, err)
+	}
+	if !held {
+		// 持有者已退出,操作系统已释放文件锁
+		return LockInfo{}, fmt.Errorf("%w: stale owner pid %d", LockNotHeldErr, owner.PID)
+	}
+	return LockInfo{
+		Key:        path,
+		Token:      owner.Token,
+		AcquiredAt: owner.AcquiredAt,
+		Hostname:   owner.Hostname,
+		PID:        owner.PID,
+		Service:    owner.Service,
+	}, nil
+}
+
+// Lock 加锁
+func (lock *FileLock) Lock(ctx context.Context) error {
+	return lock.acquire(ctx, lock, lock.tryLock)
+}
+
+// 尝试对锁文件加锁,已被他人持有时返回 LockAlreadyHeldErr
+func (lock *FileLock) tryLock(context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.file != nil {
+		return LockAlreadyHeldErr
+	}
+	file, err := os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = flock(file); err != nil {
+		_ = file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return LockAlreadyHeldErr
+		}
+		return err
+	}
+	// 锁文件在打开之后被删除或替换,加锁的文件已不是该路径指向的文件
+	if !sameFile(file, lock.path) {
+		_ = funlock(file)
+		_ = file.Close()
+		return LockAlreadyHeldErr
+	}
+	// 已持有文件锁,覆盖锁文件中残留的持有者信息
+	if err = lock.writeOwner(file); err != nil {
+		_ = funlock(file)
+		_ = file.Close()
+		return err
+	}
+	lock.file = file
+	return nil
+}
+
+// 将持有者信息写入锁文件
+func (lock *FileLock) writeOwner(file *os.File) error {
+	hostname, _ := os.Hostname()
+	owner := fileOwner{
+		Token:      lock.token,
+		Hostname:   hostname,
+		PID:        os.Getpid(),
+		AcquiredAt: lock.clock.Now(),
+	}
+	if lock.owner != nil {
+		owner.Service = lock.owner.service
+	}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	if err = file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
+
+// 文件是否仍为该路径指向的文件
+func sameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// 锁的名称
+func (lock *FileLock) name() string {
+	return lock.path
+}
+
+// 锁的身份标识
+func (lock *FileLock) identity() string {
+	return lock.token
+}
+
+// 文件锁没有有效期,无需续约,只检查锁文件是否被删除或替换
+func (lock *FileLock) delayExpire(context.Context, time.Duration, time.Duration) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	file := lock.file
+	if file == nil || !sameFile(file, lock.path) {
+		return DelayLockWithoutOwnershipErr
+	}
+	return nil
+}
+
+// Unlock 释放锁
+func (lock *FileLock) Unlock(ctx context.Context) error {
+	return lock.release(ctx, lock, lock.unlock)
+}
+
+// 清空持有者信息并释放文件锁
+func (lock *FileLock) unlock(context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	file := lock.file
+	if file == nil {
+		return UnlockWithoutOwnershipErr
+	}
+	lock.file = nil
+	owned := sameFile(file, lock.path)
+	if owned {
+		_ = file.Truncate(0)
+	}
+	if err := errors.Join(funlock(file), file.Close()); err != nil {
+		return err
+	}
+	if !owned {
+		// 锁文件已被删除或替换,不再受该锁保护
+		return UnlockWithoutOwnershipErr
+	}
+	return nil
+}
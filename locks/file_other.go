@@ -0,0 +1,33 @@
+//go:build !unix
+
+/**
+  @author: Zero
+  @date: 2023/7/12 09:58:10
+  @desc: 不支持flock的系统
+
+**/
+
+package locks
+
+import (
+	"errors"
+	"os"
+)
+
+// 文件已被其他进程加锁
+var errWouldBlock = errors.New("file lock would block")
+
+// 当前系统不支持flock
+var errFlockUnsupported = errors.New("file lock is not supported on this platform")
+
+func flock(*os.File) error {
+	return errFlockUnsupported
+}
+
+func flocked(*os.File) (bool, error) {
+	return false, errFlockUnsupported
+}
+
+func funlock(*os.File) error {
+	return errFlockUnsupported
+}
@@ -0,0 +1,110 @@
+/**
+  @author: Zero
+  @date: 2023/7/12 10:40:21
+  @desc: 文件锁单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试文件锁的互斥以及持有者信息
+func TestFileLock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "job.lock")
+	lock1 := NewFileLock(path, WithOwnerMetadata("batch-job"))
+	lock2 := NewFileLock(path)
+
+	is.NoError(lock1.Lock(ctx))
+	is.ErrorIs(lock1.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Lock(ctx), LockAlreadyHeldErr)
+	info, err := ReadFileLockInfo(path)
+	is.NoError(err)
+	is.Equal(lock1.token, info.Token)
+	is.Equal(os.Getpid(), info.PID)
+	is.Equal("batch-job", info.Service)
+
+	is.ErrorIs(lock2.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock1.Unlock(ctx))
+	_, err = ReadFileLockInfo(path)
+	is.ErrorIs(err, LockNotHeldErr)
+	is.NoError(lock2.Lock(ctx))
+	is.NoError(lock2.Unlock(ctx))
+}
+
+// 测试阻塞模式等待其他持有者释放
+func TestFileLock_Blocking(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "job.lock")
+	holder := NewFileLock(path)
+	is.NoError(holder.Lock(ctx))
+
+	waiter := NewFileLock(path, WithBlocking(), WithBlockingWaitTime(time.Millisecond*300),
+		WithRetryWaitingTime(time.Millisecond*20), WithRetry(100))
+	is.ErrorIs(waiter.Lock(ctx), LockBlockingTimeOutErr)
+	time.AfterFunc(time.Millisecond*100, func() { _ = holder.Unlock(ctx) })
+	is.NoError(waiter.Lock(ctx))
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试锁文件中残留的失效持有者信息,以及仍被加锁的锁文件不会被清理
+func TestFileLock_Stale(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "job.lock")
+	// 一个已经退出的进程
+	cmd := exec.Command("true")
+	is.NoError(cmd.Run())
+	hostname, _ := os.Hostname()
+	data, _ := json.Marshal(fileOwner{Token: "stale", Hostname: hostname, PID: cmd.Process.Pid})
+
+	// 模拟泄漏的文件描述符仍然持有锁,即使记录的持有进程已不存在也不能加锁
+	leaked, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	is.NoError(err)
+	is.NoError(flock(leaked))
+	_, err = leaked.Write(data)
+	is.NoError(err)
+	is.ErrorIs(NewFileLock(path).Lock(ctx), LockAlreadyHeldErr)
+	info, err := ReadFileLockInfo(path)
+	is.NoError(err)
+	is.Equal("stale", info.Token)
+
+	// 持有者退出后残留的持有者信息不再视为持有
+	is.NoError(leaked.Close())
+	_, err = ReadFileLockInfo(path)
+	is.ErrorIs(err, LockNotHeldErr)
+
+	// 加锁成功后残留的持有者信息被覆盖
+	lock := NewFileLock(path, WithExpire(time.Millisecond*200), WithWatchDog())
+	is.NoError(lock.Lock(ctx))
+	info, err = ReadFileLockInfo(path)
+	is.NoError(err)
+	is.Equal(lock.token, info.Token)
+	is.ErrorIs(NewFileLock(path).Lock(ctx), LockAlreadyHeldErr)
+
+	// 锁文件被删除后看门狗通知锁已丢失
+	is.NoError(os.Remove(path))
+	select {
+	case <-lock.Lost():
+		is.ErrorIs(lock.LostErr(), DelayLockWithoutOwnershipErr)
+	case <-time.After(time.Second):
+		is.Fail("lock not lost")
+	}
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+/**
+  @author: Zero
+  @date: 2023/7/12 09:58:10
+  @desc: 类Unix系统下的flock实现
+
+**/
+
+package locks
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// 文件已被其他进程加锁
+var errWouldBlock = syscall.EWOULDBLOCK
+
+// 以非阻塞方式对文件加排他锁
+func flock(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// 以非阻塞方式加共享锁,探测文件是否已被其他文件描述符加了排他锁,探测成功后立即释放
+func flocked(file *os.File) (bool, error) {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return false, funlock(file)
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return true, nil
+		case !errors.Is(err, syscall.EINTR):
+			return false, err
+		}
+	}
+}
+
+// 释放文件锁
+func funlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -16,3 +16,12 @@ type DistributedLock interface {
 	// Unlock 释放锁
 	Unlock(ctx context.Context) error
 }
+
+// LostNotifier 能够通知持有者锁已丢失的分布式锁
+// 例如启用看门狗的锁在续约失败或者到达最长持有时长时会关闭 Lost 通道
+type LostNotifier interface {
+	// Lost 返回本次持有锁期间的丢失通知
+	Lost() <-chan struct{}
+	// LostErr 返回锁丢失的原因
+	LostErr() error
+}
@@ -11,7 +11,12 @@ import (
 	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/internal/redisfake"
+	"github.com/zlx2019/sugar/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"testing"
 	"time"
 )
@@ -19,7 +24,7 @@ import (
 // 测试分布式锁,非阻塞模式
 func TestRedisDistributedLock_Lock_NotBlocking(t *testing.T) {
 	// 创建一个Redis分布式锁-非阻塞模式
-	lock := NewRedisDistributedLock("lock-key", caches.NewDefaultRedisTemplate())
+	lock := NewRedisDistributedLock("lock-key", redisfake.New(t))
 	// 加锁
 	err := lock.Lock(context.Background())
 	if err == nil {
@@ -35,17 +40,23 @@ func TestRedisDistributedLock_Lock_NotBlocking(t *testing.T) {
 func TestRedisDistributedLock_Lock_WatchDog1(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-
-	lock := NewRedisDistributedLock("dog-lock-key", caches.NewDefaultRedisTemplate(),WithExpire(time.Second * 5),WithWatchDog())
-	err := lock.Lock(context.Background())
-	is.NoError(err)
-	time.Sleep(time.Second * 10)
+	fake := clock.NewFake(time.Now())
+	template := redisfake.NewWithClock(t, fake)
+	renewed := make(chan string, 1)
+	lock := NewRedisDistributedLock("dog-lock-key", template, WithExpire(time.Second*5), WithWatchDog(), WithClock(fake),
+		OnRenew(func(key string) { renewed <- key }))
+	is.NoError(lock.Lock(context.Background()))
+	// 持有两倍有效期,看门狗每1.25秒检查一次
+	advanceWatchDog(fake, renewed, time.Millisecond*1250, 8)
+	is.True(template.Exists("dog-lock-key"))
 	is.NoError(lock.Unlock(context.Background()))
+	is.False(template.Exists("dog-lock-key"))
 
-	time.Sleep(time.Second * 5)
+	fake.Advance(time.Second * 5)
 
 	is.NoError(lock.Lock(context.Background()))
-	time.Sleep(time.Second * 10)
+	advanceWatchDog(fake, renewed, time.Millisecond*1250, 8)
+	is.True(template.Exists("dog-lock-key"))
 	is.NoError(lock.Unlock(context.Background()))
 }
 
@@ -53,17 +64,31 @@ func TestRedisDistributedLock_Lock_WatchDog1(t *testing.T) {
 func TestRedisDistributedLock_Lock_WatchDog2(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	lock := NewRedisDistributedLock("dog-lock-key", caches.NewDefaultRedisTemplate())
-	err := lock.Lock(context.Background())
-	is.NoError(err)
-	time.Sleep(time.Second * 5)
+	fake := clock.NewFake(time.Now())
+	template := redisfake.NewWithClock(t, fake)
+	renewed := make(chan string, 1)
+	lock := NewRedisDistributedLock("dog-lock-key", template, WithClock(fake), OnRenew(func(key string) { renewed <- key }))
+	is.NoError(lock.Lock(context.Background()))
+	// 默认每2.5秒检查一次,持有1.5倍有效期
+	advanceWatchDog(fake, renewed, time.Millisecond*2500, 6)
+	is.True(template.Exists("dog-lock-key"))
 	is.NoError(lock.Unlock(context.Background()))
-	time.Sleep(time.Second * 5)
+	fake.Advance(time.Second * 5)
 
 	is.NoError(lock.Lock(context.Background()))
-	time.Sleep(time.Second * 5)
+	advanceWatchDog(fake, renewed, time.Millisecond*2500, 6)
+	is.True(template.Exists("dog-lock-key"))
 	is.NoError(lock.Unlock(context.Background()))
-	time.Sleep(time.Second * 5)
+	is.False(template.Exists("dog-lock-key"))
+}
+
+// 推进n个看门狗检查间隔,每次推进后等待看门狗完成检查,避免检查被跳过
+func advanceWatchDog(fake *clock.Fake, renewed <-chan string, interval time.Duration, n int) {
+	for i := 0; i < n; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(interval)
+		<-renewed
+	}
 }
 
 
@@ -72,7 +97,7 @@ func TestRedisDistributedLock_Lock_Blocking1(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
 	// 创建Redis分布式锁,阻塞式
-	var lock DistributedLock = NewRedisDistributedLock("lock2", caches.NewDefaultRedisTemplate(), WithBlocking(),WithExpire(time.Second * 10))
+	var lock DistributedLock = NewRedisDistributedLock("lock2", redisfake.New(t), WithBlocking(),WithExpire(time.Second * 10))
 	// 加锁
 	err := lock.Lock(context.Background())
 	is.NoError(err)
@@ -91,7 +116,7 @@ func TestRedisDistributedLock_Lock_Blocking1(t *testing.T) {
 func TestRedisDistributedLock_Lock2(t *testing.T) {
 	t.Parallel()
 	is := assert.New(t)
-	lock := NewRedisDistributedLock("lock3", caches.NewDefaultRedisTemplate(), WithBlocking(), WithExpire(time.Second*10), WithBlockingWaitTime(time.Second))
+	lock := NewRedisDistributedLock("lock3", redisfake.New(t), WithBlocking(), WithExpire(time.Second*10), WithBlockingWaitTime(time.Second))
 	err := lock.Lock(context.Background())
 	is.NoError(err)
 	err = lock.Lock(context.Background())
@@ -111,4 +136,126 @@ func TestTimeProportion(t *testing.T) {
 	fmt.Println(time.Duration(float64(time.Second * 1) * 0.25))
 	fmt.Println(time.Duration(float64(time.Second * 1) * 0.3))
 	fmt.Println(time.Duration(float64(time.Second * 1) * 0.75))
-}
\ No newline at end of file
+}
+// 测试看门狗续约策略选项
+func TestWithWatchDogPolicy(t *testing.T) {
+	is := assert.New(t)
+	lock := NewRedisDistributedLock("policy-lock-key", redisfake.New(t), WithExpire(time.Second), WithWatchDogPolicy(0.5, 0.6, 2))
+	is.True(lock.enabled)
+	is.Equal(0.5, lock.interval)
+	is.Equal(0.6, lock.threshold)
+	// 非法比例使用默认值
+	is.Equal(defaultWatchDogExtension, lock.extension)
+	is.Equal(defaultMaxRenewFailures, lock.maxRenewFailures)
+}
+
+// 测试看门狗续约回调,以及锁被删除后的丢失通知
+func TestRedisDistributedLock_Lost(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	renewed := make(chan string, 10)
+	failures := make(chan int, 10)
+	lock := NewRedisDistributedLock("lost-lock-key", template, WithExpire(time.Second), WithWatchDogPolicy(0.25, 0.9, 0.75),
+		OnRenew(func(key string) {
+			select {
+			case renewed <- key:
+			default:
+			}
+		}),
+		OnRenewError(func(key string, n int, err error) { failures <- n }))
+	is.NoError(lock.Lock(context.Background()))
+	is.Equal("lost-lock-key", <-renewed)
+	is.NoError(lock.LostErr())
+
+	// 模拟锁被他人删除,看门狗应立即判定锁已丢失
+	is.NoError(template.Del("lost-lock-key"))
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second * 3):
+		t.Fatal("lock lost not notified")
+	}
+	is.Equal(1, <-failures)
+	is.ErrorIs(lock.LostErr(), LockLostErr)
+	is.ErrorIs(lock.LostErr(), DelayLockWithoutOwnershipErr)
+	is.ErrorIs(lock.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+}
+
+// 测试最长持有时长,到达后停止续约并自然过期
+func TestRedisDistributedLock_MaxHold(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	fake := clock.NewFake(time.Now())
+	template := redisfake.NewWithClock(t, fake)
+	renewed := make(chan string, 1)
+	reached := make(chan time.Duration, 1)
+	lock := NewRedisDistributedLock("max-hold-lock-key", template, WithExpire(time.Second), WithWatchDog(), WithClock(fake),
+		WithMaxHold(time.Millisecond*1500), OnRenew(func(key string) { renewed <- key }),
+		OnMaxHold(func(key string, maxHold time.Duration) { reached <- maxHold }))
+	is.NoError(lock.Lock(context.Background()))
+	// 每250毫秒检查一次,推进到最长持有时长
+	advanceWatchDog(fake, renewed, time.Millisecond*250, 5)
+	is.True(template.Exists("max-hold-lock-key"))
+	fake.Advance(time.Millisecond * 250)
+	<-lock.Lost()
+	is.Equal(time.Millisecond*1500, <-reached)
+	is.ErrorIs(lock.LostErr(), LockMaxHoldErr)
+	// 停止续约后,锁在剩余有效期内自然过期
+	fake.Advance(time.Second)
+	is.False(template.Exists("max-hold-lock-key"))
+}
+
+// 记录加锁结果的指标采集器
+type acquireRecorder struct {
+	results  []string
+	attempts []int
+}
+
+func (r *acquireRecorder) ObserveCache(string, string, time.Duration) {}
+func (r *acquireRecorder) ObserveLockAcquire(result string, attempts int, duration time.Duration) {
+	r.results = append(r.results, result)
+	r.attempts = append(r.attempts, attempts)
+}
+func (r *acquireRecorder) ObserveLockRenewal(string) {}
+
+// 测试加锁指标采集
+func TestRedisDistributedLock_Metrics(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	recorder := &acquireRecorder{}
+	lock := NewRedisDistributedLock("metrics-lock-key", redisfake.New(t), WithExpire(time.Second*5),
+		WithBlocking(), WithBlockingWaitTime(time.Second), WithRetry(3), WithRetryWaitingTime(time.Millisecond*100), WithMetrics(recorder))
+	is.NoError(lock.Lock(context.Background()))
+	is.ErrorIs(lock.Lock(context.Background()), LockNotRetryErr)
+	is.NoError(lock.Unlock(context.Background()))
+	is.Equal([]string{metrics.LockAcquired, metrics.LockRetryExhausted}, recorder.results)
+	is.Equal([]int{1, 4}, recorder.attempts)
+}
+
+// 测试加锁、持有锁以及释放锁的链路追踪
+func TestRedisDistributedLock_Tracing(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+	lock := NewRedisDistributedLock("tracing:lock-key", redisfake.New(t), WithExpire(time.Second*5), WithTracer(tracer))
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Unlock(ctx))
+	parent.End()
+
+	spans := exporter.GetSpans()
+	is.Len(spans, 4)
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+		if span.Name != "request" {
+			is.Equal(parent.SpanContext().SpanID(), span.Parent.SpanID())
+			is.Contains(span.Attributes, attribute.String("lock.key_namespace", "tracing"))
+		}
+	}
+	is.Equal([]string{"lock.Acquire", "lock.Release", "lock.Hold", "request"}, names)
+	is.Contains(spans[0].Attributes, attribute.Int("lock.attempts", 1))
+	is.Contains(spans[0].Attributes, attribute.String("lock.outcome", metrics.LockAcquired))
+}
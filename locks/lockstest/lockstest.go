@@ -0,0 +1,211 @@
+/**
+  @author: Zero
+  @date: 2023/7/17 10:40:37
+  @desc: DistributedLock 实现的一致性测试套件
+
+**/
+
+package lockstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/locks"
+)
+
+// Factory 创建一把待测试的锁,key相同的锁相互排斥
+type Factory func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock
+
+// Option 描述待测试实现的能力差异
+type Option func(*config)
+
+type config struct {
+	// 锁是否有有效期
+	expiry bool
+	// 阻塞等待是否由客户端自旋重试完成
+	clientRetry bool
+}
+
+// WithoutExpiry 锁没有有效期(例如数据库咨询锁、文件锁),跳过有效期相关的测试
+func WithoutExpiry() Option {
+	return func(c *config) {
+		c.expiry = false
+	}
+}
+
+// WithServerSideBlocking 阻塞等待由服务端完成(例如MySQL GET_LOCK),没有重试次数的限制
+func WithServerSideBlocking() Option {
+	return func(c *config) {
+		c.clientRetry = false
+	}
+}
+
+// Run 对一个 DistributedLock 实现运行一致性测试
+// 覆盖并发下的互斥、所有权校验、有效期、阻塞超时与重试次数用尽、看门狗续约以及context取消
+func Run(t *testing.T, factory Factory, opts ...Option) {
+	c := config{expiry: true, clientRetry: true}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	t.Run("MutualExclusion", func(t *testing.T) { testMutualExclusion(t, factory) })
+	t.Run("Ownership", func(t *testing.T) { testOwnership(t, factory) })
+	t.Run("Expiry", func(t *testing.T) {
+		if !c.expiry {
+			t.Skip("lock has no expiry")
+		}
+		testExpiry(t, factory)
+	})
+	t.Run("BlockingTimeout", func(t *testing.T) { testBlockingTimeout(t, factory) })
+	t.Run("RetryExhausted", func(t *testing.T) {
+		if !c.clientRetry {
+			t.Skip("blocking is done by the server")
+		}
+		testRetryExhausted(t, factory)
+	})
+	t.Run("WatchDog", func(t *testing.T) { testWatchDog(t, factory) })
+	t.Run("ContextCanceled", func(t *testing.T) { testContextCanceled(t, factory) })
+}
+
+// 每个测试使用独立的Key
+func uniqueKey(t *testing.T) string {
+	return fmt.Sprintf("lockstest:%s:%d", t.Name(), time.Now().UnixNano())
+}
+
+// 测试并发下同一时刻只有一个持有者
+func testMutualExclusion(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	key := uniqueKey(t)
+	const workers = 8
+	var holders, acquired, overlaps int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		lock := factory(t, key, locks.WithExpire(time.Second*5), locks.WithBlocking(),
+			locks.WithBlockingWaitTime(time.Second*10), locks.WithRetry(1000), locks.WithRetryWaitingTime(time.Millisecond*5))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+			if err := lock.Lock(ctx); err != nil {
+				t.Errorf("lock failed: %v", err)
+				return
+			}
+			if atomic.AddInt32(&holders, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			atomic.AddInt32(&acquired, 1)
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt32(&holders, -1)
+			if err := lock.Unlock(ctx); err != nil {
+				t.Errorf("unlock failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(int32(workers), acquired)
+	is.Zero(overlaps)
+}
+
+// 测试锁被持有时加锁失败,以及非持有者释放锁失败
+func testOwnership(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Second*5))
+	other := factory(t, key, locks.WithExpire(time.Second*5))
+
+	is.NoError(owner.Lock(ctx))
+	is.ErrorIs(other.Lock(ctx), locks.LockAlreadyHeldErr)
+	is.ErrorIs(owner.Lock(ctx), locks.LockAlreadyHeldErr)
+	is.ErrorIs(other.Unlock(ctx), locks.UnlockWithoutOwnershipErr)
+	is.NoError(owner.Unlock(ctx))
+	is.ErrorIs(owner.Unlock(ctx), locks.UnlockWithoutOwnershipErr)
+	is.NoError(other.Lock(ctx))
+	is.NoError(other.Unlock(ctx))
+}
+
+// 测试锁在有效期到达后自动失效,原持有者释放锁失败
+func testExpiry(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Millisecond*200))
+	other := factory(t, key, locks.WithExpire(time.Second*5))
+
+	is.NoError(owner.Lock(ctx))
+	time.Sleep(time.Millisecond * 400)
+	is.NoError(other.Lock(ctx))
+	is.ErrorIs(owner.Unlock(ctx), locks.UnlockWithoutOwnershipErr)
+	is.NoError(other.Unlock(ctx))
+}
+
+// 测试阻塞模式在等待时长用尽后返回 LockBlockingTimeOutErr
+func testBlockingTimeout(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Second*10))
+	waiter := factory(t, key, locks.WithExpire(time.Second*10), locks.WithBlocking(),
+		locks.WithBlockingWaitTime(time.Millisecond*300), locks.WithRetry(1000), locks.WithRetryWaitingTime(time.Millisecond*20))
+
+	is.NoError(owner.Lock(ctx))
+	is.ErrorIs(waiter.Lock(ctx), locks.LockBlockingTimeOutErr)
+	is.NoError(owner.Unlock(ctx))
+	is.NoError(waiter.Lock(ctx))
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试阻塞模式在重试次数用尽后返回 LockNotRetryErr
+func testRetryExhausted(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Second*10))
+	waiter := factory(t, key, locks.WithExpire(time.Second*10), locks.WithBlocking(),
+		locks.WithBlockingWaitTime(time.Second*10), locks.WithRetry(3), locks.WithRetryWaitingTime(time.Millisecond*20))
+
+	is.NoError(owner.Lock(ctx))
+	is.ErrorIs(waiter.Lock(ctx), locks.LockNotRetryErr)
+	is.NoError(owner.Unlock(ctx))
+}
+
+// 测试看门狗在持有期间为锁续约
+func testWatchDog(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	ctx := context.Background()
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Millisecond*300), locks.WithWatchDog())
+	other := factory(t, key, locks.WithExpire(time.Second*5))
+
+	is.NoError(owner.Lock(ctx))
+	time.Sleep(time.Millisecond * 900)
+	is.ErrorIs(other.Lock(ctx), locks.LockAlreadyHeldErr)
+	if notifier, ok := owner.(locks.LostNotifier); ok {
+		is.NoError(notifier.LostErr())
+	}
+	is.NoError(owner.Unlock(ctx))
+	is.NoError(other.Lock(ctx))
+	is.NoError(other.Unlock(ctx))
+}
+
+// 测试阻塞等待时context被取消
+func testContextCanceled(t *testing.T, factory Factory) {
+	is := assert.New(t)
+	key := uniqueKey(t)
+	owner := factory(t, key, locks.WithExpire(time.Second*10))
+	waiter := factory(t, key, locks.WithExpire(time.Second*10), locks.WithBlocking(),
+		locks.WithBlockingWaitTime(time.Second*10), locks.WithRetry(1000), locks.WithRetryWaitingTime(time.Millisecond*20))
+
+	is.NoError(owner.Lock(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	is.ErrorIs(waiter.Lock(ctx), context.DeadlineExceeded)
+	is.Less(time.Since(start), time.Second*5)
+	is.NoError(owner.Unlock(context.Background()))
+}
@@ -0,0 +1,223 @@
+/**
+  @author: Zero
+  @date: 2023/7/13 16:12:36
+  @desc: 基于进程内存的锁实现,用于单元测试以及单实例部署
+
+**/
+
+package locks
+
+import (
+	"context"
+	"github.com/zlx2019/sugar/clock"
+	"sync"
+	"time"
+)
+
+// 未指定 MemoryLocker 时共用的默认实例
+var defaultMemoryLocker = NewMemoryLocker()
+
+// MemoryLocker 进程内的锁存储,同一个 MemoryLocker 创建的同名锁相互排斥
+// 语义与Redis分布式锁保持一致: 有效期到达后自动失效、只有持有者才能释放与续约,
+// 可以在单元测试中替代Redis,或者用于单实例部署
+type MemoryLocker struct {
+	// 时钟,用于计算锁的有效期,为nil时使用系统时钟
+	// 该 MemoryLocker 创建的锁未通过 WithClock 指定时钟时也使用该时钟
+	Clock clock.Clock
+	mu    sync.Mutex
+	// 所有未释放的锁,过期的锁在下次访问时清理
+	entries map[string]*memoryEntry
+}
+
+// 一把锁的持有状态
+type memoryEntry struct {
+	// 持有者的身份标识
+	token string
+	// 过期时间
+	expireAt time.Time
+	// 重入次数
+	count int
+}
+
+// NewMemoryLocker 创建一个进程内的锁存储
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{entries: make(map[string]*memoryEntry)}
+}
+
+// NewLock 创建一把进程内的锁
+func (locker *MemoryLocker) NewLock(key string, opts ...LockOption) *MemoryLock {
+	lock := MemoryLock{
+		key:    key,
+		locker: locker,
+	}
+	// 设置锁的配置选项
+	for _, opt := range opts {
+		opt(&lock.LockOptions)
+	}
+	// 有效期由 locker 的时钟计算,加锁等待与看门狗必须使用同一个时钟,忽略 WithClock
+	lock.clock = locker.Clock
+	// 检查选项,填补默认参数
+	optionWithDefault(&lock.LockOptions)
+	lock.token = lock.tokenGenerator()
+	return &lock
+}
+
+// 当前时间
+func (locker *MemoryLocker) now() time.Time {
+	return clock.OrReal(locker.Clock).Now()
+}
+
+// 获取未过期的锁,已过期的锁直接清理,调用方需持有 mu
+func (locker *MemoryLocker) entry(key string) *memoryEntry {
+	entry, ok := locker.entries[key]
+	if !ok {
+		return nil
+	}
+	if !locker.now().Before(entry.expireAt) {
+		delete(locker.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// 尝试加锁,锁被他人持有时返回 LockAlreadyHeldErr
+// 可重入模式下同一持有者重复加锁时递增重入次数并刷新有效期
+func (locker *MemoryLocker) tryLock(key, token string, expire time.Duration, reentrant bool) error {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	entry := locker.entry(key)
+	if entry == nil {
+		locker.entries[key] = &memoryEntry{token: token, expireAt: locker.now().Add(expire), count: 1}
+		return nil
+	}
+	if !reentrant || entry.token != token {
+		return LockAlreadyHeldErr
+	}
+	entry.count++
+	entry.expireAt = locker.now().Add(expire)
+	return nil
+}
+
+// 重入已持有的锁,递增重入次数并刷新有效期
+// 锁已过期或者已被他人持有时返回 LockExpiredErr,不会重新创建锁
+func (locker *MemoryLocker) reenter(key, token string, expire time.Duration) error {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	entry := locker.entry(key)
+	if entry == nil || entry.token != token {
+		return LockExpiredErr
+	}
+	entry.count++
+	entry.expireAt = locker.now().Add(expire)
+	return nil
+}
+
+// 为锁续约,剩余有效期高于trigger时无需续约
+func (locker *MemoryLocker) delayExpire(key, token string, trigger, incr time.Duration) error {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	entry := locker.entry(key)
+	if entry == nil || entry.token != token {
+		return DelayLockWithoutOwnershipErr
+	}
+	if now := locker.now(); entry.expireAt.Sub(now) <= trigger {
+		entry.expireAt = now.Add(incr)
+	}
+	return nil
+}
+
+// 释放一次锁,返回剩余的重入次数
+func (locker *MemoryLocker) unlock(key, token string) (int, error) {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	entry := locker.entry(key)
+	if entry == nil || entry.token != token {
+		return 0, UnlockWithoutOwnershipErr
+	}
+	if entry.count--; entry.count == 0 {
+		delete(locker.entries, key)
+	}
+	return entry.count, nil
+}
+
+// MemoryLock 进程内的锁,实现与Redis分布式锁相同的语义
+// 包括有效期、所有权校验、阻塞模式下的自旋重试、看门狗续约,以及可选的可重入
+type MemoryLock struct {
+	// 锁的功能配置
+	LockOptions
+	// 锁存储
+	locker *MemoryLocker
+	// 锁的Key
+	key string
+	// 锁的身份标识
+	token string
+	// 本对象的重入次数
+	holds int
+}
+
+// NewMemoryLock 使用默认的 MemoryLocker 创建一把进程内的锁
+func NewMemoryLock(key string, opts ...LockOption) *MemoryLock {
+	return defaultMemoryLocker.NewLock(key, opts...)
+}
+
+// Lock 加锁
+func (lock *MemoryLock) Lock(ctx context.Context) error {
+	if lock.reentrant && lock.holds > 0 {
+		// 重入时看门狗已经在运行,只需递增重入次数
+		// 锁已过期时拒绝重入,已有的持有需要全部释放后重新加锁
+		if err := lock.locker.reenter(lock.key, lock.token, lock.expire); err != nil {
+			return err
+		}
+		lock.holds++
+		return nil
+	}
+	return lock.acquire(ctx, lock, lock.tryLock)
+}
+
+// 尝试加锁
+func (lock *MemoryLock) tryLock(context.Context) error {
+	if err := lock.locker.tryLock(lock.key, lock.token, lock.expire, lock.reentrant); err != nil {
+		return err
+	}
+	// 重新获取的锁总是一次新的持有,不会累加已过期的持有次数
+	lock.holds = 1
+	return nil
+}
+
+// 锁的名称
+func (lock *MemoryLock) name() string {
+	return lock.key
+}
+
+// 锁的身份标识
+func (lock *MemoryLock) identity() string {
+	return lock.token
+}
+
+// 本次持有锁的过期时刻以及计时使用的时钟
+func (lock *MemoryLock) expiry() (time.Time, clock.Clock) {
+	return lock.expiresAt, lock.clock
+}
+
+// 为锁的有效期续约
+func (lock *MemoryLock) delayExpire(_ context.Context, triggerTime, incrTime time.Duration) error {
+	return lock.locker.delayExpire(lock.key, lock.token, triggerTime, incrTime)
+}
+
+// Unlock 释放锁,可重入模式下释放次数与加锁次数相同时才真正释放
+func (lock *MemoryLock) Unlock(ctx context.Context) error {
+	if lock.reentrant && lock.holds > 1 {
+		// 锁已过期时释放失败,仍然消耗一次持有,保证加锁与释放的次数对应
+		lock.holds--
+		_, err := lock.locker.unlock(lock.key, lock.token)
+		return err
+	}
+	return lock.release(ctx, lock, lock.unlock)
+}
+
+// 释放锁
+func (lock *MemoryLock) unlock(context.Context) error {
+	lock.holds = 0
+	_, err := lock.locker.unlock(lock.key, lock.token)
+	return err
+}
@@ -0,0 +1,195 @@
+/**
+  @author: Zero
+  @date: 2023/7/13 17:05:49
+  @desc: 进程内锁单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+)
+
+// 测试进程内锁的互斥、所有权以及有效期
+func TestMemoryLock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	lock1 := locker.NewLock("memory:order", WithExpire(time.Millisecond*100))
+	lock2 := locker.NewLock("memory:order", WithExpire(time.Millisecond*100))
+
+	is.NoError(lock1.Lock(ctx))
+	is.ErrorIs(lock1.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Unlock(ctx), UnlockWithoutOwnershipErr)
+	// 有效期到达后自动失效
+	time.Sleep(time.Millisecond * 150)
+	is.NoError(lock2.Lock(ctx))
+	is.ErrorIs(lock1.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock2.Unlock(ctx))
+	// 不同的 MemoryLocker 互不影响
+	is.NoError(NewMemoryLocker().NewLock("memory:order").Lock(ctx))
+}
+
+// 测试阻塞模式等待其他持有者释放以及等待超时
+func TestMemoryLock_Blocking(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	holder := locker.NewLock("memory:blocking")
+	is.NoError(holder.Lock(ctx))
+
+	waiter := locker.NewLock("memory:blocking", WithBlocking(), WithBlockingWaitTime(time.Millisecond*300),
+		WithRetryWaitingTime(time.Millisecond*20), WithRetry(100))
+	is.ErrorIs(waiter.Lock(ctx), LockBlockingTimeOutErr)
+	time.AfterFunc(time.Millisecond*100, func() { _ = holder.Unlock(ctx) })
+	is.NoError(waiter.Lock(ctx))
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试看门狗为进程内锁续约
+func TestMemoryLock_WatchDog(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	lock := locker.NewLock("memory:dog", WithExpire(time.Millisecond*100), WithWatchDog())
+	is.NoError(lock.Lock(ctx))
+	time.Sleep(time.Millisecond * 300)
+	is.ErrorIs(locker.NewLock("memory:dog").Lock(ctx), LockAlreadyHeldErr)
+	is.NoError(lock.Unlock(ctx))
+}
+
+// 测试可重入锁,加锁几次就需要释放几次
+func TestMemoryLock_Reentrant(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	lock := locker.NewLock("memory:reentrant", WithReentrant(), WithWatchDog())
+	other := locker.NewLock("memory:reentrant")
+
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Unlock(ctx))
+	is.ErrorIs(other.Lock(ctx), LockAlreadyHeldErr)
+	is.NoError(lock.Unlock(ctx))
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(other.Lock(ctx))
+	is.NoError(other.Unlock(ctx))
+}
+
+// 测试可重入锁过期后拒绝重入
+func TestMemoryLock_ReentrantExpired(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	locker := NewMemoryLocker()
+	locker.Clock = fake
+	lock := locker.NewLock("memory:reentrant-expired", WithReentrant(), WithExpire(time.Second))
+
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Lock(ctx))
+	fake.Advance(time.Second)
+	is.ErrorIs(lock.Lock(ctx), LockExpiredErr)
+	// 已有的两次持有都已失效
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+	// 全部释放后可以重新加锁
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Lock(ctx))
+	is.NoError(lock.Unlock(ctx))
+	is.NoError(lock.Unlock(ctx))
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+}
+
+// 测试不可重入的锁过期后重新加锁,只记为一次持有,释放时真正释放锁
+func TestMemoryLock_RelockExpired(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	locker := NewMemoryLocker()
+	locker.Clock = fake
+	lock := locker.NewLock("memory:relock-expired", WithExpire(time.Second))
+
+	is.NoError(lock.Lock(ctx))
+	fake.Advance(time.Second)
+	is.NoError(lock.Lock(ctx))
+	is.Equal(1, lock.holds)
+	is.NoError(lock.Unlock(ctx))
+	is.Zero(lock.holds)
+	is.ErrorIs(lock.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(locker.NewLock("memory:relock-expired").Lock(ctx))
+}
+
+// 测试通过手动时钟控制有效期与阻塞等待,无需真实等待
+func TestMemoryLock_FakeClock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	locker := NewMemoryLocker()
+	locker.Clock = fake
+	holder := locker.NewLock("memory:fake", WithExpire(time.Second*10))
+	is.NoError(holder.Lock(ctx))
+
+	// 阻塞等待超时,锁总是使用 locker 的时钟,WithClock 不生效
+	waiter := locker.NewLock("memory:fake", WithBlocking(), WithBlockingWaitTime(time.Second*3), WithRetry(100),
+		WithClock(clock.Real()))
+	done := make(chan error, 1)
+	go func() { done <- waiter.Lock(ctx) }()
+	// 等待超时定时器与重试定时器
+	fake.BlockUntil(2)
+	fake.Advance(time.Second * 3)
+	is.ErrorIs(<-done, LockBlockingTimeOutErr)
+
+	// 有效期到达后其他人可以加锁
+	fake.Advance(time.Second * 7)
+	is.NoError(waiter.Lock(ctx))
+	is.ErrorIs(holder.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试通过手动时钟驱动看门狗续约以及最长持有时长
+func TestMemoryLock_FakeClockWatchDog(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Now())
+	locker := NewMemoryLocker()
+	locker.Clock = fake
+	renewed := make(chan struct{}, 1)
+	lock := locker.NewLock("memory:fake-dog", WithExpire(time.Second*10), WithWatchDog(), WithMaxHold(time.Second*30),
+		OnRenew(func(string) {
+			select {
+			case renewed <- struct{}{}:
+			default:
+			}
+		}))
+	is.NoError(lock.Lock(ctx))
+
+	// 每2.5秒检查一次,推进到有效期的两倍仍然持有
+	for i := 0; i < 8; i++ {
+		fake.BlockUntil(2)
+		fake.Advance(time.Millisecond * 2500)
+		<-renewed
+	}
+	is.ErrorIs(locker.NewLock("memory:fake-dog").Lock(ctx), LockAlreadyHeldErr)
+
+	// 到达最长持有时长后停止续约
+	fake.Advance(time.Second * 10)
+	<-lock.Lost()
+	is.ErrorIs(lock.LostErr(), LockMaxHoldErr)
+	fake.Advance(time.Second * 10)
+	is.NoError(locker.NewLock("memory:fake-dog").Lock(ctx))
+}
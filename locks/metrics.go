@@ -0,0 +1,30 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 16:48:03
+  @desc: 锁的指标采集工具
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"github.com/zlx2019/sugar/metrics"
+)
+
+// 根据加锁返回的错误获取加锁结果
+func acquireResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.LockAcquired
+	case errors.Is(err, LockBlockingTimeOutErr):
+		return metrics.LockTimeout
+	case errors.Is(err, LockNotRetryErr):
+		return metrics.LockRetryExhausted
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return metrics.LockCanceled
+	default:
+		return metrics.LockFailed
+	}
+}
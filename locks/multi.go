@@ -0,0 +1,207 @@
+/**
+  @author: Zero
+  @date: 2023/6/20 15:30:08
+  @desc: 基于Redis的多Key原子锁
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/sugar/clock"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisMultiLock 基于Redis的多Key锁
+// 所有Key通过一个Lua脚本原子性地全部获取或者全部不获取,避免逐个加锁带来的死锁以及部分加锁问题
+// 多个Key共用一个身份标识,由同一个看门狗一起续约
+type RedisMultiLock struct {
+	// 锁的功能配置
+	LockOptions
+	// Redis客户端
+	template caches.RedisTemplate
+	// 锁的Key列表,已排序并去重
+	keys []string
+	// 保护持有状态,看门狗会并发访问
+	mu sync.Mutex
+	// 当前持有的Key列表
+	held []string
+	// 锁的身份标识,用于防止锁被他人释放
+	token string
+}
+
+// NewRedisMultiLock 创建一个Redis多Key锁,Key列表为空时返回 LockEmptyKeysErr
+func NewRedisMultiLock(keys []string, template caches.RedisTemplate, opts ...LockOption) (*RedisMultiLock, error) {
+	if len(keys) == 0 {
+		return nil, LockEmptyKeysErr
+	}
+	lock := RedisMultiLock{
+		keys:     sortedKeys(keys),
+		template: template,
+	}
+	// 设置锁的配置选项
+	for _, opt := range opts {
+		opt(&lock.LockOptions)
+	}
+	// 检查选项,填补默认参数
+	optionWithDefault(&lock.LockOptions)
+	lock.token = lock.tokenGenerator()
+	return &lock, nil
+}
+
+// 对Key列表排序并去重,保证所有持有者以相同的顺序加锁
+func sortedKeys(keys []string) []string {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// 在锁的Key列表之后追加对应的持有信息Key,作为多Key脚本的KEYS
+func withOwnerKeys(keys []string) []string {
+	all := make([]string, 0, len(keys)*2)
+	all = append(all, keys...)
+	for _, key := range keys {
+		all = append(all, OwnerKey(key))
+	}
+	return all
+}
+
+// 加锁脚本的参数: 身份标识、有效期、加锁时间以及可选的持有者信息
+func (lock *RedisMultiLock) acquireArgs() []any {
+	args := []any{lock.token, lock.expire.Milliseconds(), lock.clock.Now().UnixMilli()}
+	return append(args, lock.owner.args()...)
+}
+
+// Lock 加锁,所有Key全部获取成功才算加锁成功
+func (lock *RedisMultiLock) Lock(ctx context.Context) error {
+	return lock.acquire(ctx, lock, lock.tryLock)
+}
+
+// 尝试一次性获取所有Key
+func (lock *RedisMultiLock) tryLock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	val, err := lock.template.EvalScript(ctx, multiLockScript, withOwnerKeys(lock.keys), lock.acquireArgs()...).Result()
+	if err != nil {
+		return err
+	}
+	if v, ok := val.(int64); !ok || v != 1 {
+		// 至少有一个Key已被他人持有
+		return LockAlreadyHeldErr
+	}
+	lock.held = lock.keys
+	return nil
+}
+
+// TryLockMany 尽可能多地获取Key,返回成功获取的Key列表
+// 与 Lock 不同,部分Key已被他人持有时,仍然持有其余的Key
+// 一个Key都没有获取到时返回 LockAlreadyHeldErr,阻塞模式下会继续重试
+func (lock *RedisMultiLock) TryLockMany(ctx context.Context) ([]string, error) {
+	if err := lock.acquire(ctx, lock, lock.tryLockMany); err != nil {
+		return nil, err
+	}
+	return lock.Keys(), nil
+}
+
+// 尝试获取所有未被持有的Key
+func (lock *RedisMultiLock) tryLockMany(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	val, err := lock.template.EvalScript(ctx, tryLockManyScript, withOwnerKeys(lock.keys), lock.acquireArgs()...).Result()
+	if err != nil {
+		return err
+	}
+	values, _ := val.([]any)
+	if len(values) == 0 {
+		return LockAlreadyHeldErr
+	}
+	held := make([]string, 0, len(values))
+	for _, v := range values {
+		if key, ok := v.(string); ok {
+			held = append(held, key)
+		}
+	}
+	lock.held = held
+	return nil
+}
+
+// Keys 返回当前持有的Key列表
+func (lock *RedisMultiLock) Keys() []string {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return append([]string(nil), lock.held...)
+}
+
+// 锁的名称
+func (lock *RedisMultiLock) name() string {
+	return strings.Join(lock.keys, ",")
+}
+
+// 锁的身份标识
+func (lock *RedisMultiLock) identity() string {
+	return lock.token
+}
+
+// 本次持有锁的过期时刻以及计时使用的时钟
+func (lock *RedisMultiLock) expiry() (time.Time, clock.Clock) {
+	return lock.expiresAt, lock.clock
+}
+
+// 为持有的所有Key一起续约,任意一个Key已不属于自己则续约失败
+func (lock *RedisMultiLock) delayExpire(ctx context.Context, triggerTime, incrTime time.Duration) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	val, err := lock.template.EvalScript(ctx, multiLockExpireDelayScript, withOwnerKeys(lock.held), lock.token, triggerTime.Milliseconds(), incrTime.Milliseconds()).Result()
+	if err != nil {
+		return err
+	}
+	if v, ok := val.(int64); ok && v != 1 {
+		return DelayLockWithoutOwnershipErr
+	}
+	return nil
+}
+
+// Unlock 原子性地释放所有持有的Key
+// 任意一个Key已不属于自己时返回 UnlockWithoutOwnershipErr,其余Key仍会被释放
+func (lock *RedisMultiLock) Unlock(ctx context.Context) error {
+	err := lock.release(ctx, lock, lock.unlock)
+	if errors.Is(err, UnlockWithoutOwnershipErr) && lock.enabled {
+		// 部分Key已失效时其余Key同样已被释放,不再续约
+		lock.stopWatchDog()
+	}
+	return err
+}
+
+// 通过Lua脚本释放所有持有的Key
+func (lock *RedisMultiLock) unlock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if len(lock.held) == 0 {
+		return UnlockWithoutOwnershipErr
+	}
+	val, err := lock.template.EvalScript(ctx, multiUnlockScript, withOwnerKeys(lock.held), lock.token).Result()
+	if err != nil {
+		return err
+	}
+	released := len(lock.held)
+	lock.held = nil
+	if v, ok := val.(int64); ok && v != int64(released) {
+		// 部分Key已经提前失效或者被他人持有
+		return UnlockWithoutOwnershipErr
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/**
+  @author: Zero
+  @date: 2023/6/20 16:40:55
+  @desc: Redis多Key锁单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+// 测试多Key锁的全部获取或者全部不获取
+func TestRedisMultiLock_Lock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	// 顺序不同的两组Key,排序后加锁顺序一致
+	lock1, err := NewRedisMultiLock([]string{"multi:account-b", "multi:account-a"}, template, WithExpire(time.Second*5))
+	is.NoError(err)
+	lock2, err := NewRedisMultiLock([]string{"multi:account-a", "multi:account-c", "multi:account-a"}, template, WithExpire(time.Second*5))
+	is.NoError(err)
+	is.Equal([]string{"multi:account-a", "multi:account-c"}, lock2.keys)
+
+	is.NoError(lock1.Lock(context.Background()))
+	is.Equal([]string{"multi:account-a", "multi:account-b"}, lock1.Keys())
+	// 每个Key都记录持有信息
+	info, err := NewAdmin(template).Get(context.Background(), "multi:account-b")
+	is.NoError(err)
+	is.Equal(lock1.token, info.Token)
+	is.False(info.AcquiredAt.IsZero())
+	// account-a 已被持有,account-c 也不能被获取
+	is.ErrorIs(lock2.Lock(context.Background()), LockAlreadyHeldErr)
+	is.False(template.Exists("multi:account-c"))
+
+	is.NoError(lock1.Unlock(context.Background()))
+	is.False(template.Exists("multi:account-a"))
+	is.False(template.Exists(OwnerKey("multi:account-a")))
+	is.NoError(lock2.Lock(context.Background()))
+	is.NoError(lock2.Unlock(context.Background()))
+}
+
+// 测试尽可能多地获取Key
+func TestRedisMultiLock_TryLockMany(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	single := NewRedisDistributedLock("many:key-2", template, WithExpire(time.Second*5))
+	is.NoError(single.Lock(context.Background()))
+
+	lock, err := NewRedisMultiLock([]string{"many:key-1", "many:key-2", "many:key-3"}, template, WithExpire(time.Second*5))
+	is.NoError(err)
+	obtained, err := lock.TryLockMany(context.Background())
+	is.NoError(err)
+	is.Equal([]string{"many:key-1", "many:key-3"}, obtained)
+	is.NoError(lock.Unlock(context.Background()))
+	is.NoError(single.Unlock(context.Background()))
+}
+
+// 测试多Key锁由同一个看门狗一起续约
+func TestRedisMultiLock_WatchDog(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	fake := clock.NewFake(time.Now())
+	template := redisfake.NewWithClock(t, fake)
+	renewed := make(chan string, 1)
+	lock, err := NewRedisMultiLock([]string{"dog:multi-1", "dog:multi-2"}, template, WithExpire(time.Second), WithClock(fake),
+		WithWatchDogPolicy(0.25, 0.9, 0.75), OnRenew(func(key string) { renewed <- key }))
+	is.NoError(err)
+	is.NoError(lock.Lock(context.Background()))
+	fake.BlockUntil(1)
+	fake.Advance(time.Millisecond * 250)
+	is.Equal("dog:multi-1,dog:multi-2", <-renewed)
+	// 持有1.5倍有效期
+	advanceWatchDog(fake, renewed, time.Millisecond*250, 5)
+	is.True(template.Exists("dog:multi-1"))
+	is.True(template.Exists("dog:multi-2"))
+
+	// 其中一个Key被删除后,整体视为锁已丢失
+	is.NoError(template.Del("dog:multi-2"))
+	fake.Advance(time.Millisecond * 250)
+	<-lock.Lost()
+	is.ErrorIs(lock.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+}
+
+// 测试Key列表为空时拒绝创建
+func TestRedisMultiLock_EmptyKeys(t *testing.T) {
+	is := assert.New(t)
+	_, err := NewRedisMultiLock(nil, redisfake.New(t))
+	is.ErrorIs(err, LockEmptyKeysErr)
+	_, err = NewRedisMultiLock([]string{}, redisfake.New(t))
+	is.ErrorIs(err, LockEmptyKeysErr)
+}
+
+// 测试部分Key已失效时释放其余Key,并且不再持有、停止看门狗
+func TestRedisMultiLock_PartialUnlock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	lock, err := NewRedisMultiLock([]string{"partial:a", "partial:b"}, template, WithExpire(time.Second*5), WithWatchDog())
+	is.NoError(err)
+	is.NoError(lock.Lock(context.Background()))
+	is.NoError(template.Del("partial:b"))
+
+	is.ErrorIs(lock.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+	is.False(template.Exists("partial:a"))
+	is.Empty(lock.Keys())
+	is.Eventually(func() bool { return atomic.LoadInt32(&lock.status) == stop }, time.Second, time.Millisecond*10)
+	is.ErrorIs(lock.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+	// 可以重新加锁
+	is.NoError(lock.Lock(context.Background()))
+	is.NoError(lock.Unlock(context.Background()))
+}
@@ -0,0 +1,174 @@
+/**
+  @author: Zero
+  @date: 2023/7/11 14:20:08
+  @desc: 基于MySQL命名锁(GET_LOCK)的分布式锁实现
+
+**/
+
+package locks
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// 获取命名锁,超时返回0
+	mysqlGetLockQuery = "SELECT GET_LOCK(?, ?)"
+	// 释放命名锁,锁不属于当前会话返回0,锁不存在返回NULL
+	mysqlReleaseLockQuery = "SELECT RELEASE_LOCK(?)"
+	// MySQL命名锁名称的最大长度
+	mysqlMaxLockName = 64
+)
+
+// MySQLLock 基于MySQL GET_LOCK/RELEASE_LOCK 的分布式锁
+// 加锁时从连接池中独占一个连接,命名锁随连接(会话)存在,释放锁后归还连接
+// 阻塞模式下由MySQL服务端等待,等待时长为 WithBlockingWaitTime(按秒向上取整),超时返回 LockBlockingTimeOutErr
+//
+// 命名锁没有有效期,WithExpire 仅用于计算看门狗的检查间隔;
+// 启用看门狗时定期检查连接是否仍然有效,失效时通过 Lost 通知持有者
+type MySQLLock struct {
+	// 锁的功能配置
+	LockOptions
+	// 连接池
+	db *sql.DB
+	// 锁的Key
+	key string
+	// 命名锁的名称
+	lockName string
+	// 锁的身份标识,仅用于日志与链路追踪
+	token string
+	// 保护持有状态,看门狗会并发访问
+	mu sync.Mutex
+	// 持有锁的连接
+	conn *sql.Conn
+}
+
+// NewMySQLLock 创建一个MySQL分布式锁
+func NewMySQLLock(key string, db *sql.DB, opts ...LockOption) *MySQLLock {
+	lock := MySQLLock{
+		key:      key,
+		db:       db,
+		lockName: mysqlLockName(key),
+	}
+	// 设置锁的配置选项
+	for _, opt := range opts {
+		opt(&lock.LockOptions)
+	}
+	// 检查选项,填补默认参数
+	optionWithDefault(&lock.LockOptions)
+	lock.token = lock.tokenGenerator()
+	return &lock
+}
+
+// 命名锁的名称最长64个字符,超出时使用Key的SHA1作为名称
+func mysqlLockName(key string) string {
+	if len(key) <= mysqlMaxLockName {
+		return key
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lock 加锁
+func (lock *MySQLLock) Lock(ctx context.Context) error {
+	return lock.acquire(ctx, lock, lock.tryLock)
+}
+
+// 通过GET_LOCK获取命名锁,非阻塞模式下不等待
+func (lock *MySQLLock) tryLock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.conn != nil {
+		// 命名锁在同一会话中可重入,这里与其他实现保持一致,不允许重复加锁
+		return LockAlreadyHeldErr
+	}
+	var timeout int64
+	if lock.blocking {
+		timeout = int64(math.Ceil(lock.blockingTime.Seconds()))
+	}
+	conn, err := lock.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	var result sql.NullInt64
+	if err = conn.QueryRowContext(ctx, mysqlGetLockQuery, lock.lockName, timeout).Scan(&result); err != nil || result.Int64 != 1 {
+		// 加锁失败时归还连接
+		_ = conn.Close()
+		switch {
+		case err != nil:
+			return err
+		case !result.Valid:
+			return fmt.Errorf("get lock %s failed", lock.lockName)
+		case lock.blocking:
+			return LockBlockingTimeOutErr
+		default:
+			return LockAlreadyHeldErr
+		}
+	}
+	lock.conn = conn
+	return nil
+}
+
+// 锁的名称
+func (lock *MySQLLock) name() string {
+	return lock.key
+}
+
+// 锁的身份标识
+func (lock *MySQLLock) identity() string {
+	return lock.token
+}
+
+// 命名锁没有有效期,无需续约,只检查持有锁的连接是否仍然有效
+func (lock *MySQLLock) delayExpire(ctx context.Context, _, _ time.Duration) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	conn := lock.conn
+	if conn == nil {
+		return DelayLockWithoutOwnershipErr
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		// 连接断开,命名锁已被数据库释放
+		return fmt.Errorf("%w: %w", DelayLockWithoutOwnershipErr, err)
+	}
+	return nil
+}
+
+// Unlock 释放锁
+func (lock *MySQLLock) Unlock(ctx context.Context) error {
+	return lock.release(ctx, lock, lock.unlock)
+}
+
+// 通过RELEASE_LOCK释放命名锁并归还连接
+func (lock *MySQLLock) unlock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	conn := lock.conn
+	if conn == nil {
+		return UnlockWithoutOwnershipErr
+	}
+	lock.conn = nil
+	var result sql.NullInt64
+	if err := conn.QueryRowContext(ctx, mysqlReleaseLockQuery, lock.lockName).Scan(&result); err != nil {
+		// 释放失败时丢弃该连接,关闭会话后数据库会释放该会话持有的所有命名锁
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		_ = conn.Close()
+		return err
+	}
+	if err := conn.Close(); err != nil {
+		return err
+	}
+	if result.Int64 != 1 {
+		// 锁不存在或者不属于当前会话
+		return UnlockWithoutOwnershipErr
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/**
+  @author: Zero
+  @date: 2023/7/11 15:03:44
+  @desc: MySQL命名锁单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/sqlfake"
+)
+
+// 测试命名锁的互斥以及所有权
+func TestMySQLLock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	db := sqlfake.New().DB()
+	ctx := context.Background()
+	lock1 := NewMySQLLock("mysql:order", db)
+	lock2 := NewMySQLLock("mysql:order", db)
+
+	is.NoError(lock1.Lock(ctx))
+	is.ErrorIs(lock1.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock1.Unlock(ctx))
+	is.ErrorIs(lock1.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock2.Lock(ctx))
+	is.NoError(lock2.Unlock(ctx))
+	is.Equal(0, db.Stats().InUse)
+}
+
+// 测试阻塞模式由GET_LOCK等待,超时返回 LockBlockingTimeOutErr
+func TestMySQLLock_Blocking(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	db := sqlfake.New().DB()
+	ctx := context.Background()
+	holder := NewMySQLLock("mysql:blocking", db)
+	is.NoError(holder.Lock(ctx))
+
+	waiter := NewMySQLLock("mysql:blocking", db, WithBlocking(), WithBlockingWaitTime(time.Second))
+	start := time.Now()
+	is.ErrorIs(waiter.Lock(ctx), LockBlockingTimeOutErr)
+	is.GreaterOrEqual(time.Since(start), time.Second)
+
+	time.AfterFunc(time.Millisecond*100, func() { _ = holder.Unlock(ctx) })
+	is.NoError(waiter.Lock(ctx))
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试连接断开后看门狗通知锁已丢失
+func TestMySQLLock_Lost(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	server := sqlfake.New()
+	lock := NewMySQLLock("mysql:lost", server.DB(), WithExpire(time.Millisecond*200), WithWatchDog())
+	is.NoError(lock.Lock(context.Background()))
+
+	server.KillAll()
+	select {
+	case <-lock.Lost():
+		is.ErrorIs(lock.LostErr(), DelayLockWithoutOwnershipErr)
+	case <-time.After(time.Second):
+		is.Fail("lock not lost")
+	}
+}
+
+func TestMySQLLockName(t *testing.T) {
+	is := assert.New(t)
+	is.Equal("mysql:order", mysqlLockName("mysql:order"))
+	long := strings.Repeat("k", 100)
+	is.Len(mysqlLockName(long), 40)
+}
@@ -9,6 +9,11 @@ package locks
 
 import (
 	"context"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/logs"
+	"github.com/zlx2019/sugar/metrics"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"time"
 )
 
@@ -20,6 +25,15 @@ const (
 	// 默认加锁重试次数为5次
 	defaultRetry = 5
 
+	// 看门狗默认每隔有效期的25%检查一次
+	defaultWatchDogInterval = 0.25
+	// 看门狗默认在剩余有效期不足30%时续约
+	defaultWatchDogThreshold = 0.3
+	// 看门狗默认每次续约有效期的75%
+	defaultWatchDogExtension = 0.75
+	// 看门狗默认连续续约失败3次后视为锁已丢失
+	defaultMaxRenewFailures = 3
+
 	// 看门狗状态
 	stop = 0 // 停止
 	running = 1 //运行
@@ -38,15 +52,38 @@ type LockOptions struct {
 	// 阻塞模式下阻塞的时长,默认为3s
 	blockingTime time.Duration
 
+	// 是否可重入,同一持有者可以重复加锁,加锁几次就需要释放几次
+	reentrant bool
+
 	// 阻塞模式下重试获取锁的次数,默认为5
 	retry int
 	// 每次重试间隔等待时间,默认为 阻塞时长/重试次数 (blockingTime / retry)
 	retryWaitingTime time.Duration
+
+	// 锁的身份标识生成器,默认为 RandomToken
+	tokenGenerator TokenGenerator
+	// 持有者信息,为nil时不记录
+	owner *ownerMetadata
+	// 是否维护加锁计数(fencing token)
+	fencing bool
+
+	// 日志组件,默认不输出日志
+	logger logs.Logger
+	// 指标采集器,默认不采集
+	metrics metrics.Recorder
+	// 链路追踪器,默认不追踪
+	tracer trace.Tracer
+	// 时钟,用于加锁等待、看门狗计时等,默认为系统时钟
+	clock clock.Clock
+	// 本次持有锁期间的Span
+	holdSpan trace.Span
+	// 本次持有锁的过期时刻,取成功的那次加锁尝试开始时刻加上有效时长,不随看门狗续约更新
+	expiresAt time.Time
 }
 
 // WatchDog 看门狗,为锁的有效期自动续约
-// 规则: 每%25的时间比例检查一次是否续约,不足%30则续约
-// 每次续约%75的时间比例
+// 默认规则: 每%25的时间比例检查一次是否续约,不足%30则续约
+// 每次续约%75的时间比例,可通过 WithWatchDogPolicy 调整
 type WatchDog struct {
 	// 是否启用看门狗: 如果用户没有显示为锁添加有效期,那么就启动看门狗
 	enabled bool
@@ -54,6 +91,25 @@ type WatchDog struct {
 	status int32
 	// 用于关闭看门狗的函数
 	cancelFn context.CancelFunc
+
+	// 检查间隔占有效期的比例
+	interval float64
+	// 剩余有效期低于该比例时触发续约
+	threshold float64
+	// 每次续约时长占有效期的比例
+	extension float64
+	// 允许连续续约失败的次数,超过后视为锁已丢失
+	maxRenewFailures int
+	// 每次续约成功后的回调
+	onRenew func(key string)
+	// 每次续约失败后的回调,failures为连续失败的次数
+	onRenewError func(key string, failures int, err error)
+	// 最长持有时长,到达后停止续约,为0表示不限制
+	maxHold time.Duration
+	// 到达最长持有时长后的回调
+	onMaxHold func(key string, maxHold time.Duration)
+	// 本次持有锁期间的丢失通知
+	lost *lostSignal
 }
 
 // LockOption 选项闭包
@@ -101,6 +157,134 @@ func WithWatchDog()LockOption {
 	}
 }
 
+// WithWatchDogPolicy 设置看门狗的续约策略,并启用看门狗
+// 参数均为占锁有效期的比例,取值范围(0,1],非法值将使用默认值
+// interval: 检查间隔, threshold: 触发续约的剩余有效期, extension: 每次续约的时长
+func WithWatchDogPolicy(interval, threshold, extension float64) LockOption {
+	return func(options *LockOptions) {
+		options.enabled = true
+		options.interval = interval
+		options.threshold = threshold
+		options.extension = extension
+	}
+}
+
+// WithMaxRenewFailures 设置看门狗允许连续续约失败的次数
+// 超过该次数后看门狗停止运行,锁被视为已丢失
+func WithMaxRenewFailures(n int) LockOption {
+	return func(options *LockOptions) {
+		options.maxRenewFailures = n
+	}
+}
+
+// OnRenew 设置看门狗每次续约成功后的回调
+func OnRenew(fn func(key string)) LockOption {
+	return func(options *LockOptions) {
+		options.onRenew = fn
+	}
+}
+
+// OnRenewError 设置看门狗每次续约失败后的回调
+// failures 为截止本次连续失败的次数
+func OnRenewError(fn func(key string, failures int, err error)) LockOption {
+	return func(options *LockOptions) {
+		options.onRenewError = fn
+	}
+}
+
+// WithMaxHold 设置锁的最长持有时长
+// 从加锁成功开始计算,到达该时长后看门狗停止续约,锁将在剩余有效期后自然过期
+// 避免持有者卡死时无限续约而导致其他人永远无法获取锁
+func WithMaxHold(maxHold time.Duration) LockOption {
+	return func(options *LockOptions) {
+		options.maxHold = maxHold
+	}
+}
+
+// OnMaxHold 设置到达最长持有时长后的回调
+func OnMaxHold(fn func(key string, maxHold time.Duration)) LockOption {
+	return func(options *LockOptions) {
+		options.onMaxHold = fn
+	}
+}
+
+// WithReentrant 设置锁为可重入锁,持有者可以重复加锁,加锁几次就需要释放几次
+// 身份标识相同的锁视为同一持有者,目前由 MemoryLock 支持
+func WithReentrant() LockOption {
+	return func(options *LockOptions) {
+		options.reentrant = true
+	}
+}
+
+// WithToken 设置锁的身份标识,需要保证每个持有者的标识唯一
+// 默认为随机字符串,可以用来标识锁的持有者,例如选主时的候选者身份
+func WithToken(token string) LockOption {
+	return WithTokenGenerator(func() string {
+		return token
+	})
+}
+
+// WithTokenGenerator 设置锁的身份标识生成器
+// 内置 RandomToken、UUIDToken、ProcessToken,也可以使用自定义的生成器
+func WithTokenGenerator(generator TokenGenerator) LockOption {
+	return func(options *LockOptions) {
+		options.tokenGenerator = generator
+	}
+}
+
+// WithOwnerMetadata 加锁时记录持有者信息: 主机名、进程ID以及服务名称
+// 持有者信息与身份标识一起保存在 OwnerKey 中,可以通过 Admin 查询
+func WithOwnerMetadata(service string) LockOption {
+	return func(options *LockOptions) {
+		options.owner = newOwnerMetadata(service)
+	}
+}
+
+// WithFencing 加锁时递增 FenceKey 中的加锁计数,通过 Fence 获取本次持有锁的fencing token
+// 为了保证加锁计数单调递增,FenceKey 会永久保存,只对需要fencing token的锁启用
+func WithFencing() LockOption {
+	return func(options *LockOptions) {
+		options.fencing = true
+	}
+}
+
+// WithLogger 设置锁的日志组件
+func WithLogger(logger logs.Logger) LockOption {
+	return func(options *LockOptions) {
+		options.logger = logger
+	}
+}
+
+// WithMetrics 设置锁的指标采集器,采集加锁耗时、尝试次数、超时以及续约等指标
+func WithMetrics(recorder metrics.Recorder) LockOption {
+	return func(options *LockOptions) {
+		options.metrics = recorder
+	}
+}
+
+// WithTracer 设置锁的链路追踪器,为加锁、持有锁以及释放锁创建Span
+func WithTracer(tracer trace.Tracer) LockOption {
+	return func(options *LockOptions) {
+		options.tracer = tracer
+	}
+}
+
+// WithClock 设置锁使用的时钟,测试时可以注入 clock.Fake 手动推进时间
+// 进程内锁总是使用 MemoryLocker.Clock,忽略该选项
+func WithClock(c clock.Clock) LockOption {
+	return func(options *LockOptions) {
+		options.clock = c
+	}
+}
+
+// 校验比例是否合法,不合法则返回默认值
+func ratioOrDefault(ratio, def float64) float64 {
+	if ratio <= 0 || ratio > 1 {
+		return def
+	}
+	return ratio
+}
+
 // 设置默认选项参数
 // 如果没有设置某项参数,则使用默认参数
 func optionWithDefault(options *LockOptions) {
@@ -124,4 +308,20 @@ func optionWithDefault(options *LockOptions) {
 		// 设置间隔时间,以毫秒为单位
 		options.retryWaitingTime = time.Millisecond * time.Duration(sleep)
 	}
+	// 看门狗续约策略
+	options.interval = ratioOrDefault(options.interval, defaultWatchDogInterval)
+	options.threshold = ratioOrDefault(options.threshold, defaultWatchDogThreshold)
+	options.extension = ratioOrDefault(options.extension, defaultWatchDogExtension)
+	if options.maxRenewFailures <= 0 {
+		options.maxRenewFailures = defaultMaxRenewFailures
+	}
+	if options.tokenGenerator == nil {
+		options.tokenGenerator = RandomToken
+	}
+	options.clock = clock.OrReal(options.clock)
+	options.logger = logs.OrNop(options.logger)
+	options.metrics = metrics.OrNop(options.metrics)
+	if options.tracer == nil {
+		options.tracer = noop.NewTracerProvider().Tracer("")
+	}
 }
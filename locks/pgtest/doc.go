@@ -0,0 +1,11 @@
+/**
+  @author: Zero
+  @date: 2023/7/10 14:20:37
+  @desc: PostgreSQL分布式锁的集成测试
+
+**/
+
+// Package pgtest 通过真实的PostgreSQL驱动(lib/pq)测试 locks.PostgresLock
+// 位于独立的模块中,避免库的使用者继承驱动依赖;
+// 设置环境变量 SUGAR_POSTGRES_DSN 后在该目录下执行 go test ./... 运行,未设置时跳过
+package pgtest
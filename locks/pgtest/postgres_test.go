@@ -0,0 +1,78 @@
+/**
+  @author: Zero
+  @date: 2023/7/10 14:20:37
+  @desc: 基于真实PostgreSQL驱动的咨询锁测试
+
+**/
+
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/locks"
+	"github.com/zlx2019/sugar/locks/lockstest"
+)
+
+// 连接 SUGAR_POSTGRES_DSN 指定的数据库,未设置时跳过测试
+func openDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("SUGAR_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SUGAR_POSTGRES_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 每次运行使用独立的Key前缀,避免与其他进程持有的咨询锁冲突
+var prefix = fmt.Sprintf("pgtest:%d:", time.Now().UnixNano())
+
+func TestConformance_Postgres(t *testing.T) {
+	db := openDB(t)
+	lockstest.Run(t, func(t *testing.T, key string, opts ...locks.LockOption) locks.DistributedLock {
+		return locks.NewPostgresLock(prefix+key, db, opts...)
+	}, lockstest.WithoutExpiry())
+}
+
+// 测试事务级咨询锁不会启动看门狗,调用方可以持续使用事务,事务结束时释放锁
+func TestPostgresTxLock(t *testing.T) {
+	is := assert.New(t)
+	db := openDB(t)
+	ctx := context.Background()
+	key := prefix + "tx"
+	tx, err := db.BeginTx(ctx, nil)
+	is.NoError(err)
+	defer func() { _ = tx.Rollback() }()
+
+	// 较短的检查间隔,如果看门狗访问调用方的事务会与下面的查询并发
+	lock := locks.NewPostgresTxLock(key, tx, locks.WithExpire(time.Millisecond*40), locks.WithWatchDog())
+	is.NoError(lock.Lock(ctx))
+	is.Nil(lock.Lost())
+	is.ErrorIs(locks.NewPostgresLock(key, db).Lock(ctx), locks.LockAlreadyHeldErr)
+
+	deadline := time.Now().Add(time.Millisecond * 500)
+	for time.Now().Before(deadline) {
+		var now time.Time
+		is.NoError(tx.QueryRowContext(ctx, "SELECT now()").Scan(&now))
+	}
+	is.NoError(tx.Commit())
+	is.NoError(lock.Unlock(ctx))
+
+	other := locks.NewPostgresLock(key, db)
+	is.NoError(other.Lock(ctx))
+	is.NoError(other.Unlock(ctx))
+}
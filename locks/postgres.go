@@ -0,0 +1,193 @@
+/**
+  @author: Zero
+  @date: 2023/7/10 10:05:27
+  @desc: 基于PostgreSQL咨询锁(advisory lock)的分布式锁实现
+
+**/
+
+package locks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// 获取会话级咨询锁
+	pgTryLockQuery = "SELECT pg_try_advisory_lock($1)"
+	// 获取事务级咨询锁
+	pgTryXactLockQuery = "SELECT pg_try_advisory_xact_lock($1)"
+	// 释放会话级咨询锁
+	pgUnlockQuery = "SELECT pg_advisory_unlock($1)"
+)
+
+// PostgresLock 基于PostgreSQL咨询锁的分布式锁
+// 锁的Key通过FNV-64a哈希为bigint作为咨询锁的Key,支持两种模式:
+//   - 会话级: 加锁时从连接池中独占一个连接,锁随连接(会话)存在,释放锁后归还连接
+//   - 事务级: 在调用方的事务中加锁,锁在事务提交或者回滚时由数据库自动释放
+//
+// 咨询锁没有有效期,WithExpire 仅用于计算看门狗的检查间隔;
+// 会话级模式启用看门狗时定期检查持有锁的连接是否仍然有效,失效时通过 Lost 通知持有者;
+// 事务级模式从不启动看门狗,*sql.Tx 不支持并发使用,锁只在调用方的事务中访问
+type PostgresLock struct {
+	// 锁的功能配置
+	LockOptions
+	// 会话级模式使用的连接池
+	db *sql.DB
+	// 事务级模式使用的事务
+	tx *sql.Tx
+	// 锁的Key
+	key string
+	// 咨询锁的Key
+	id int64
+	// 锁的身份标识,仅用于日志与链路追踪
+	token string
+	// 保护持有状态,看门狗会并发访问
+	mu sync.Mutex
+	// 会话级模式下持有锁的连接
+	conn *sql.Conn
+	// 事务级模式下是否持有锁
+	held bool
+}
+
+// NewPostgresLock 创建一个会话级的PostgreSQL分布式锁
+func NewPostgresLock(key string, db *sql.DB, opts ...LockOption) *PostgresLock {
+	return newPostgresLock(&PostgresLock{key: key, db: db}, opts)
+}
+
+// NewPostgresTxLock 创建一个事务级的PostgreSQL分布式锁,锁在事务结束时自动释放
+// 看门狗相关的选项不生效
+func NewPostgresTxLock(key string, tx *sql.Tx, opts ...LockOption) *PostgresLock {
+	lock := newPostgresLock(&PostgresLock{key: key, tx: tx}, opts)
+	lock.enabled = false
+	return lock
+}
+
+func newPostgresLock(lock *PostgresLock, opts []LockOption) *PostgresLock {
+	// 设置锁的配置选项
+	for _, opt := range opts {
+		opt(&lock.LockOptions)
+	}
+	// 检查选项,填补默认参数
+	optionWithDefault(&lock.LockOptions)
+	lock.id = AdvisoryLockKey(lock.key)
+	lock.token = lock.tokenGenerator()
+	return lock
+}
+
+// AdvisoryLockKey 将锁的Key通过FNV-64a哈希为咨询锁使用的bigint
+func AdvisoryLockKey(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// Lock 加锁
+func (lock *PostgresLock) Lock(ctx context.Context) error {
+	return lock.acquire(ctx, lock, lock.tryLock)
+}
+
+// 尝试获取咨询锁,已被他人持有时返回 LockAlreadyHeldErr
+func (lock *PostgresLock) tryLock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.conn != nil || lock.held {
+		// 咨询锁在同一会话中可重入,这里与其他实现保持一致,不允许重复加锁
+		return LockAlreadyHeldErr
+	}
+	if lock.tx != nil {
+		var ok bool
+		if err := lock.tx.QueryRowContext(ctx, pgTryXactLockQuery, lock.id).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return LockAlreadyHeldErr
+		}
+		lock.held = true
+		return nil
+	}
+	conn, err := lock.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if err = conn.QueryRowContext(ctx, pgTryLockQuery, lock.id).Scan(&ok); err != nil || !ok {
+		// 加锁失败时归还连接,避免阻塞模式下长时间占用连接
+		_ = conn.Close()
+		if err != nil {
+			return err
+		}
+		return LockAlreadyHeldErr
+	}
+	lock.conn = conn
+	return nil
+}
+
+// 锁的名称
+func (lock *PostgresLock) name() string {
+	return lock.key
+}
+
+// 锁的身份标识
+func (lock *PostgresLock) identity() string {
+	return lock.token
+}
+
+// 咨询锁没有有效期,无需续约,只检查持有锁的连接是否仍然有效
+// 事务级模式不会启动看门狗,这里也不会访问调用方的事务
+func (lock *PostgresLock) delayExpire(ctx context.Context, _, _ time.Duration) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.conn == nil {
+		return DelayLockWithoutOwnershipErr
+	}
+	if err := lock.conn.PingContext(ctx); err != nil {
+		// 连接断开,咨询锁已被数据库释放
+		return fmt.Errorf("%w: %w", DelayLockWithoutOwnershipErr, err)
+	}
+	return nil
+}
+
+// Unlock 释放锁
+// 事务级模式下咨询锁只能在事务结束时释放,这里仅标记为不再持有
+func (lock *PostgresLock) Unlock(ctx context.Context) error {
+	return lock.release(ctx, lock, lock.unlock)
+}
+
+// 释放咨询锁并归还连接
+func (lock *PostgresLock) unlock(ctx context.Context) error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.tx != nil {
+		if !lock.held {
+			return UnlockWithoutOwnershipErr
+		}
+		lock.held = false
+		return nil
+	}
+	conn := lock.conn
+	if conn == nil {
+		return UnlockWithoutOwnershipErr
+	}
+	lock.conn = nil
+	var ok bool
+	if err := conn.QueryRowContext(ctx, pgUnlockQuery, lock.id).Scan(&ok); err != nil {
+		// 释放失败时丢弃该连接,关闭会话后数据库会释放该会话持有的所有咨询锁
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		_ = conn.Close()
+		return err
+	}
+	if err := conn.Close(); err != nil {
+		return err
+	}
+	if !ok {
+		// 会话已不再持有该锁
+		return UnlockWithoutOwnershipErr
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/**
+  @author: Zero
+  @date: 2023/7/10 11:02:16
+  @desc: PostgreSQL咨询锁单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/sqlfake"
+)
+
+// 测试会话级咨询锁的互斥以及所有权
+func TestPostgresLock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	db := sqlfake.New().DB()
+	ctx := context.Background()
+	lock1 := NewPostgresLock("pg:order", db)
+	lock2 := NewPostgresLock("pg:order", db)
+
+	is.NoError(lock1.Lock(ctx))
+	is.ErrorIs(lock1.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Lock(ctx), LockAlreadyHeldErr)
+	is.ErrorIs(lock2.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock1.Unlock(ctx))
+	is.ErrorIs(lock1.Unlock(ctx), UnlockWithoutOwnershipErr)
+	is.NoError(lock2.Lock(ctx))
+	is.NoError(lock2.Unlock(ctx))
+	// 释放锁后归还连接
+	is.Equal(0, db.Stats().InUse)
+}
+
+// 测试阻塞模式等待其他持有者释放以及等待超时
+func TestPostgresLock_Blocking(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	db := sqlfake.New().DB()
+	ctx := context.Background()
+	holder := NewPostgresLock("pg:blocking", db)
+	is.NoError(holder.Lock(ctx))
+
+	waiter := NewPostgresLock("pg:blocking", db, WithBlocking(), WithBlockingWaitTime(time.Millisecond*300),
+		WithRetryWaitingTime(time.Millisecond*20), WithRetry(100))
+	is.ErrorIs(waiter.Lock(ctx), LockBlockingTimeOutErr)
+
+	time.AfterFunc(time.Millisecond*100, func() { _ = holder.Unlock(ctx) })
+	is.NoError(waiter.Lock(ctx))
+	is.NoError(waiter.Unlock(ctx))
+}
+
+// 测试事务级咨询锁在事务结束时释放
+func TestPostgresTxLock(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	db := sqlfake.New().DB()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	is.NoError(err)
+	// 即使没有设置有效期也不会启动看门狗,避免与调用方并发使用同一个事务
+	lock := NewPostgresTxLock("pg:tx", tx, WithWatchDog())
+	is.NoError(lock.Lock(ctx))
+	is.Nil(lock.Lost())
+	is.ErrorIs(NewPostgresLock("pg:tx", db).Lock(ctx), LockAlreadyHeldErr)
+
+	is.NoError(tx.Commit())
+	is.NoError(lock.Unlock(ctx))
+	other := NewPostgresLock("pg:tx", db)
+	is.NoError(other.Lock(ctx))
+	is.NoError(other.Unlock(ctx))
+}
+
+// 测试连接断开后看门狗通知锁已丢失
+func TestPostgresLock_Lost(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	server := sqlfake.New()
+	lock := NewPostgresLock("pg:lost", server.DB(), WithExpire(time.Millisecond*200), WithWatchDog())
+	is.NoError(lock.Lock(context.Background()))
+
+	server.KillAll()
+	select {
+	case <-lock.Lost():
+		is.ErrorIs(lock.LostErr(), LockLostErr)
+		is.ErrorIs(lock.LostErr(), DelayLockWithoutOwnershipErr)
+	case <-time.After(time.Second):
+		is.Fail("lock not lost")
+	}
+	is.Error(lock.Unlock(context.Background()))
+}
+
+func TestAdvisoryLockKey(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(AdvisoryLockKey("pg:order"), AdvisoryLockKey("pg:order"))
+	is.NotEqual(AdvisoryLockKey("pg:order"), AdvisoryLockKey("pg:user"))
+}
@@ -7,10 +7,40 @@
 
 package locks
 
+import "github.com/zlx2019/sugar/caches"
+
+// LockAcquireScript 用于加锁的Lua脚本命令
+// KEYS[1]: 锁的`key`, KEYS[2]: 持有信息`key`, KEYS[3]: 可选的加锁计数`key`
+// ARGV[1]: token, ARGV[2]: 有效期毫秒数, ARGV[3]: 加锁时间, ARGV[4...]: 可选的持有者信息字段与值
+// 当`key`不存在时设置为`token`,并记录持有信息,持有信息与锁的有效期保持一致
+// 传入KEYS[3]时递增加锁计数并返回(fencing token),否则返回`1`;`key`已存在则返回`0`
+const LockAcquireScript = `
+	local token = ARGV[1]
+	local expire = ARGV[2]
+	if not redis.call('set',KEYS[1],token,'PX',expire,'NX') then
+		return 0
+	end
+	redis.call('del',KEYS[2])
+	redis.call('hset',KEYS[2],'token',token,'acquired_at',ARGV[3])
+	local fence = 1
+	if KEYS[3] then
+		fence = redis.call('incr',KEYS[3])
+		redis.call('hset',KEYS[2],'fence',fence)
+	end
+	for i = 4, #ARGV, 2 do
+		redis.call('hset',KEYS[2],ARGV[i],ARGV[i + 1])
+	end
+	redis.call('pexpire',KEYS[2],expire)
+	return fence
+`
+
 // UnlockLuaScript 用于释放锁的Lua脚本命令
-// 如果`key`的value和指定的参数值相等才删除这个`key`
+// 如果`key`的value和指定的参数值相等才删除这个`key`,以及可选的持有信息`KEYS[2]`
 const UnlockLuaScript = `
 	if redis.call('get',KEYS[1]) == ARGV[1] then
+		if KEYS[2] then
+			redis.call('del',KEYS[2])
+		end
 		return redis.call('del',KEYS[1])
 	else
 		return 0
@@ -20,6 +50,7 @@ const UnlockLuaScript = `
 // LockExpireDelayScript 用于为锁有效期续约的Lua脚本命令
 // 当`key`的value和`token`相等 && key的剩余有效期小于`triggerVal`时才进行续约
 // 如果当前剩余有效期大于`triggerVal`和续约成功都返回`1`。key不存在或者token不一致则返回`0`
+// 续约时同时为可选的持有信息`KEYS[2]`续约
 const LockExpireDelayScript = `
 	local key = KEYS[1]
 	local token = ARGV[1]
@@ -32,7 +63,110 @@ const LockExpireDelayScript = `
 			return 1
 		else
 			local incrVal = ARGV[3]
+			if KEYS[2] then
+				redis.call('pexpire',KEYS[2],incrVal)
+			end
 			return redis.call('pexpire',key,incrVal)
 		end
 	end
-`
\ No newline at end of file
+`
+
+// MultiLockScript 用于同时获取多把锁的Lua脚本命令
+// KEYS[1...n]: 锁的`key`, KEYS[n+1...2n]: 对应的持有信息`key`
+// ARGV[1]: token, ARGV[2]: 有效期毫秒数, ARGV[3]: 加锁时间, ARGV[4...]: 可选的持有者信息字段与值
+// 只有当所有`key`都不存在时,才将它们全部设置为`token`并记录持有信息,否则一个都不设置
+// 全部设置成功返回`1`,否则返回`0`
+const MultiLockScript = `
+	local token = ARGV[1]
+	local expire = ARGV[2]
+	local n = #KEYS / 2
+	for i = 1, n do
+		if redis.call('exists',KEYS[i]) == 1 then
+			return 0
+		end
+	end
+	for i = 1, n do
+		redis.call('set',KEYS[i],token,'PX',expire)
+		local owner = KEYS[n + i]
+		redis.call('del',owner)
+		redis.call('hset',owner,'token',token,'acquired_at',ARGV[3])
+		for j = 4, #ARGV, 2 do
+			redis.call('hset',owner,ARGV[j],ARGV[j + 1])
+		end
+		redis.call('pexpire',owner,expire)
+	end
+	return 1
+`
+
+// TryLockManyScript 用于尽可能多地获取锁的Lua脚本命令
+// KEYS与ARGV同 MultiLockScript
+// 逐个设置不存在的`key`并记录持有信息,返回成功获取的`key`列表
+const TryLockManyScript = `
+	local token = ARGV[1]
+	local expire = ARGV[2]
+	local n = #KEYS / 2
+	local obtained = {}
+	for i = 1, n do
+		if redis.call('set',KEYS[i],token,'PX',expire,'NX') then
+			local owner = KEYS[n + i]
+			redis.call('del',owner)
+			redis.call('hset',owner,'token',token,'acquired_at',ARGV[3])
+			for j = 4, #ARGV, 2 do
+				redis.call('hset',owner,ARGV[j],ARGV[j + 1])
+			end
+			redis.call('pexpire',owner,expire)
+			table.insert(obtained,KEYS[i])
+		end
+	end
+	return obtained
+`
+
+// MultiUnlockScript 用于同时释放多把锁的Lua脚本命令
+// KEYS[1...n]: 锁的`key`, KEYS[n+1...2n]: 对应的持有信息`key`
+// 只删除value与`token`相等的`key`及其持有信息,返回删除的锁数量
+const MultiUnlockScript = `
+	local token = ARGV[1]
+	local n = #KEYS / 2
+	local count = 0
+	for i = 1, n do
+		if redis.call('get',KEYS[i]) == token then
+			redis.call('del',KEYS[n + i])
+			count = count + redis.call('del',KEYS[i])
+		end
+	end
+	return count
+`
+
+// MultiLockExpireDelayScript 用于为多把锁同时续约的Lua脚本命令
+// KEYS[1...n]: 锁的`key`, KEYS[n+1...2n]: 对应的持有信息`key`
+// 所有`key`的value都与`token`相等时,才为剩余有效期小于`triggerVal`的`key`及其持有信息续约
+// 续约成功返回`1`,任意一个`key`不存在或者token不一致则返回`0`
+const MultiLockExpireDelayScript = `
+	local token = ARGV[1]
+	local triggerVal = tonumber(ARGV[2])
+	local incrVal = ARGV[3]
+	local n = #KEYS / 2
+	for i = 1, n do
+		if redis.call('get',KEYS[i]) ~= token then
+			return 0
+		end
+	end
+	for i = 1, n do
+		if redis.call('pttl',KEYS[i]) <= triggerVal then
+			redis.call('pexpire',KEYS[i],incrVal)
+			redis.call('pexpire',KEYS[n + i],incrVal)
+		end
+	end
+	return 1
+`
+
+// 锁组件使用的脚本,通过EVALSHA调用,避免每次请求都发送脚本内容
+var (
+	lockAcquireScript          = caches.NewScript("sugar_lock_acquire", LockAcquireScript)
+	unlockScript               = caches.NewScript("sugar_unlock", UnlockLuaScript)
+	lockExpireDelayScript      = caches.NewScript("sugar_lock_expire_delay", LockExpireDelayScript)
+	multiLockScript            = caches.NewScript("sugar_multi_lock", MultiLockScript)
+	tryLockManyScript          = caches.NewScript("sugar_try_lock_many", TryLockManyScript)
+	multiUnlockScript          = caches.NewScript("sugar_multi_unlock", MultiUnlockScript)
+	multiLockExpireDelayScript = caches.NewScript("sugar_multi_lock_expire_delay", MultiLockExpireDelayScript)
+)
@@ -0,0 +1,77 @@
+/**
+  @author: Zero
+  @date: 2023/7/5 10:22:17
+  @desc: 锁的身份标识生成器以及持有者信息
+
+**/
+
+package locks
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/zlx2019/toys/randoms"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// TokenGenerator 锁的身份标识生成器,每创建一把锁调用一次
+// 生成的标识需要保证在所有持有者之间唯一
+type TokenGenerator func() string
+
+// RandomToken 生成15位随机字符串作为身份标识,为默认的生成器
+func RandomToken() string {
+	return randoms.RandomString(15)
+}
+
+// UUIDToken 生成UUIDv4作为身份标识
+func UUIDToken() string {
+	return uuid.NewString()
+}
+
+// 进程内的身份标识序号,保证同一协程创建的多把锁标识不同
+var processTokenSeq atomic.Uint64
+
+// ProcessToken 使用 主机名 + 进程ID + 协程ID + 序号 作为身份标识,便于排查持有者
+// 协程ID为创建锁时所在的协程,序号在进程内递增,同一协程创建的多把锁不会共用标识
+func ProcessToken() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s_%s_%d", hostname, GetLockToken(), processTokenSeq.Add(1))
+}
+
+// 持有者信息字段
+const (
+	ownerFieldHostname = "hostname"
+	ownerFieldPID      = "pid"
+	ownerFieldService  = "service"
+)
+
+// 持有者信息,加锁时与身份标识一起记录在 OwnerKey 中
+type ownerMetadata struct {
+	hostname string
+	pid      int
+	service  string
+}
+
+// 创建当前进程的持有者信息
+func newOwnerMetadata(service string) *ownerMetadata {
+	hostname, _ := os.Hostname()
+	return &ownerMetadata{
+		hostname: hostname,
+		pid:      os.Getpid(),
+		service:  service,
+	}
+}
+
+// 转换为加锁脚本的字段参数
+func (owner *ownerMetadata) args() []any {
+	if owner == nil {
+		return nil
+	}
+	return []any{
+		ownerFieldHostname, owner.hostname,
+		ownerFieldPID, strconv.Itoa(owner.pid),
+		ownerFieldService, owner.service,
+	}
+}
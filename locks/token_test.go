@@ -0,0 +1,64 @@
+/**
+  @author: Zero
+  @date: 2023/7/5 11:10:34
+  @desc: 身份标识生成器以及持有者信息单元测试
+
+**/
+
+package locks
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/internal/redisfake"
+)
+
+// 测试内置的身份标识生成器
+func TestTokenGenerator(t *testing.T) {
+	is := assert.New(t)
+	template := redisfake.New(t)
+	is.Len(NewRedisDistributedLock("token-key", template).token, 15)
+
+	_, err := uuid.Parse(NewRedisDistributedLock("token-key", template, WithTokenGenerator(UUIDToken)).token)
+	is.NoError(err)
+
+	hostname, _ := os.Hostname()
+	token := NewRedisDistributedLock("token-key", template, WithTokenGenerator(ProcessToken)).token
+	is.True(strings.HasPrefix(token, hostname+"_"+strconv.Itoa(os.Getpid())+"_"))
+	// 同一协程创建的锁身份标识不同
+	is.NotEqual(token, NewRedisDistributedLock("token-key", template, WithTokenGenerator(ProcessToken)).token)
+
+	is.Equal("custom", NewRedisDistributedLock("token-key", template, WithTokenGenerator(func() string {
+		return "custom"
+	})).token)
+}
+
+// 测试记录持有者信息,并且释放锁时仍然精确校验身份标识
+func TestWithOwnerMetadata(t *testing.T) {
+	t.Parallel()
+	is := assert.New(t)
+	template := redisfake.New(t)
+	lock := NewRedisDistributedLock("owner:order-1", template, WithExpire(time.Second*10),
+		WithTokenGenerator(UUIDToken), WithOwnerMetadata("payment"))
+	is.NoError(lock.Lock(context.Background()))
+
+	info, err := NewAdmin(template).Get(context.Background(), "owner:order-1")
+	is.NoError(err)
+	hostname, _ := os.Hostname()
+	is.Equal(lock.token, info.Token)
+	is.Equal(hostname, info.Hostname)
+	is.Equal(os.Getpid(), info.PID)
+	is.Equal("payment", info.Service)
+
+	// 其他持有者无法释放
+	other := NewRedisDistributedLock("owner:order-1", template, WithOwnerMetadata("payment"))
+	is.ErrorIs(other.Unlock(context.Background()), UnlockWithoutOwnershipErr)
+	is.NoError(lock.Unlock(context.Background()))
+}
@@ -0,0 +1,48 @@
+/**
+  @author: Zero
+  @date: 2023/6/18 14:36:52
+  @desc: 锁的链路追踪工具
+
+**/
+
+package locks
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 链路追踪属性
+const (
+	// 锁Key的命名空间
+	attrLockNamespace = attribute.Key("lock.key_namespace")
+	// 是否为阻塞模式
+	attrLockBlocking = attribute.Key("lock.blocking")
+	// 加锁尝试次数
+	attrLockAttempts = attribute.Key("lock.attempts")
+	// 操作结果
+	attrLockOutcome = attribute.Key("lock.outcome")
+)
+
+// 结束加锁Span,记录尝试次数与加锁结果
+func endAcquireSpan(span trace.Span, attempts int, err error) {
+	span.SetAttributes(attrLockAttempts.Int(attempts), attrLockOutcome.String(acquireResult(err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// 结束释放锁Span,记录释放结果
+func endReleaseSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(attrLockOutcome.String("failed"))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attrLockOutcome.String("released"))
+	}
+	span.End()
+}
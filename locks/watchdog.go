@@ -0,0 +1,179 @@
+/**
+  @author: Zero
+  @date: 2023/6/20 10:12:45
+  @desc: 看门狗,为锁的有效期自动续约
+
+**/
+
+package locks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zlx2019/sugar/metrics"
+	"go.opentelemetry.io/otel/trace"
+	"sync/atomic"
+	"time"
+)
+
+// 锁丢失通知,每次加锁成功后重新创建
+type lostSignal struct {
+	// 锁丢失时关闭
+	ch chan struct{}
+	// 锁丢失的原因,在ch关闭前写入
+	err error
+}
+
+// 可被看门狗续约的锁
+type renewable interface {
+	// 锁的名称,用于日志、回调以及链路追踪
+	name() string
+	// 锁的身份标识
+	identity() string
+	// 为锁的有效期执行续约操作
+	// triggerTime: 触发续约的阈值,当剩余有效期低于该数值才会续约
+	// incrTime: 要续约的时长
+	delayExpire(ctx context.Context, triggerTime, incrTime time.Duration) error
+}
+
+// 初始化看门狗运行状态
+func (options *LockOptions) doWatchDog(ctx context.Context, target renewable) {
+	// 更新状态: 将status从`0`更改为`1`;从静止状态更新为运行状态
+	// 这里主要是确保之前开启的看门狗已经被停止了
+	for !atomic.CompareAndSwapInt32(&options.status, stop, running) {
+	}
+	options.logger.Debug("watch dog started", "key", target.name(), "token", target.identity())
+	// 获取看门狗的停止函数
+	ctx, options.cancelFn = context.WithCancel(ctx)
+	// 每次持有锁都使用新的丢失通知
+	lost := &lostSignal{ch: make(chan struct{})}
+	options.lost = lost
+	// 启动看门狗异步任务
+	go func() {
+		// 在任务结束之前,将状态恢复到停止状态
+		defer func() {
+			atomic.StoreInt32(&options.status, stop)
+			options.logger.Debug("watch dog stopped", "key", target.name(), "token", target.identity())
+		}()
+		if err := options.runningWatchDog(ctx, target); err != nil {
+			// 续约失败,通知持有者锁已丢失
+			trace.SpanFromContext(ctx).AddEvent("lock lost", trace.WithAttributes(attrLockOutcome.String(err.Error())))
+			lost.err = err
+			close(lost.ch)
+		}
+	}()
+}
+
+// 停止看门狗
+func (options *LockOptions) stopWatchDog() {
+	if options.cancelFn != nil {
+		options.cancelFn()
+	}
+}
+
+// 运行续约异步任务,看门狗被停止时返回nil,锁丢失时返回 LockLostErr
+// 到达最长持有时长时返回 LockMaxHoldErr
+func (options *LockOptions) runningWatchDog(ctx context.Context, target renewable) error {
+	// 轮询间隔时间
+	intervalTime := time.Duration(float64(options.expire) * options.interval)
+	// 触发续约的剩余有效期
+	triggerTime := time.Duration(float64(options.expire) * options.threshold)
+	// 每次续约的时长
+	incrTime := time.Duration(float64(options.expire) * options.extension)
+	options.logger.Debug("watch dog policy", "key", target.name(), "interval", intervalTime, "trigger", triggerTime, "extension", incrTime)
+	// 根据间隔时间创建一个定时器
+	loop := options.clock.NewTicker(intervalTime)
+	defer loop.Stop()
+	// 最长持有期限,到达后停止续约,为0表示不限制
+	var deadline time.Time
+	var holdTimeout <-chan time.Time
+	if options.maxHold > 0 {
+		deadline = options.clock.Now().Add(options.maxHold)
+		holdTimer := options.clock.NewTimer(options.maxHold)
+		defer holdTimer.Stop()
+		holdTimeout = holdTimer.C()
+	}
+	// 连续续约失败的次数
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			// 已释放锁,停止任务
+			return nil
+		case <-holdTimeout:
+			// 到达最长持有时长,停止续约,锁将在剩余有效期后自然过期
+			return options.maxHoldReached(target)
+		case <-loop.C():
+		}
+		// 续约时长不能超出最长持有期限
+		incr := incrTime
+		if !deadline.IsZero() {
+			remaining := options.clock.Until(deadline)
+			if remaining <= 0 {
+				return options.maxHoldReached(target)
+			}
+			if remaining < incr {
+				incr = remaining
+			}
+		}
+		// 执行续约
+		err := target.delayExpire(ctx, triggerTime, incr)
+		if err == nil {
+			failures = 0
+			options.metrics.ObserveLockRenewal(metrics.RenewOk)
+			options.logger.Debug("watch dog renewed", "key", target.name(), "token", target.identity(), "duration", incr)
+			if options.onRenew != nil {
+				options.onRenew(target.name())
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// 续约期间锁被释放
+			return nil
+		}
+		failures++
+		options.metrics.ObserveLockRenewal(metrics.RenewError)
+		options.logger.Warn("watch dog renew failed", "key", target.name(), "token", target.identity(), "failures", failures, "error", err)
+		if options.onRenewError != nil {
+			options.onRenewError(target.name(), failures, err)
+		}
+		// 锁已不属于自己,无需再重试
+		if errors.Is(err, DelayLockWithoutOwnershipErr) || failures >= options.maxRenewFailures {
+			options.logger.Error("lock lost", "key", target.name(), "token", target.identity(), "error", err)
+			return fmt.Errorf("%w: %w", LockLostErr, err)
+		}
+	}
+}
+
+// 到达最长持有时长,通知持有者并上报事件
+func (options *LockOptions) maxHoldReached(target renewable) error {
+	options.logger.Warn("watch dog stop renewing, max hold time reached", "key", target.name(), "token", target.identity(), "duration", options.maxHold)
+	if options.onMaxHold != nil {
+		options.onMaxHold(target.name(), options.maxHold)
+	}
+	return LockMaxHoldErr
+}
+
+// Lost 返回本次持有锁期间的丢失通知
+// 当看门狗连续续约失败超过上限、锁已被他人持有或者到达最长持有时长时,该通道会被关闭
+// 未加锁或者未启用看门狗时返回nil
+func (dog *WatchDog) Lost() <-chan struct{} {
+	if dog.lost == nil {
+		return nil
+	}
+	return dog.lost.ch
+}
+
+// LostErr 返回锁丢失的原因,锁未丢失时返回nil
+func (dog *WatchDog) LostErr() error {
+	if dog.lost == nil {
+		return nil
+	}
+	select {
+	case <-dog.lost.ch:
+		return dog.lost.err
+	default:
+		return nil
+	}
+}
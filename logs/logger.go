@@ -0,0 +1,80 @@
+/**
+  @author: Zero
+  @date: 2023/6/12 10:20:15
+  @desc: 可插拔的结构化日志组件
+
+**/
+
+package logs
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger 结构化日志接口
+// args 为交替出现的键值对,例如: logger.Info("lock acquired", "key", key, "token", token)
+type Logger interface {
+	// Debug 调试日志
+	Debug(msg string, args ...any)
+	// Info 普通日志
+	Info(msg string, args ...any)
+	// Warn 警告日志
+	Warn(msg string, args ...any)
+	// Error 错误日志
+	Error(msg string, args ...any)
+}
+
+// 不输出任何内容的日志实现
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// Nop 返回一个不输出任何内容的日志实现,作为组件的默认日志
+func Nop() Logger {
+	return nopLogger{}
+}
+
+// OrNop 如果logger为nil,则返回 Nop()
+func OrNop(logger Logger) Logger {
+	if logger == nil {
+		return Nop()
+	}
+	return logger
+}
+
+// SlogLogger 基于 log/slog 的日志适配器
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger 使用slog创建日志适配器,logger为nil时使用 slog.Default()
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{logger: logger}
+}
+
+// Debug 调试日志
+func (l *SlogLogger) Debug(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelDebug, msg, args...)
+}
+
+// Info 普通日志
+func (l *SlogLogger) Info(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+// Warn 警告日志
+func (l *SlogLogger) Warn(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelWarn, msg, args...)
+}
+
+// Error 错误日志
+func (l *SlogLogger) Error(msg string, args ...any) {
+	l.logger.Log(context.Background(), slog.LevelError, msg, args...)
+}
@@ -0,0 +1,36 @@
+/**
+  @author: Zero
+  @date: 2023/6/12 10:45:02
+  @desc: 日志组件单元测试
+
+**/
+
+package logs
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试slog适配器输出结构化字段
+func TestSlogLogger(t *testing.T) {
+	is := assert.New(t)
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	logger.Debug("renew", "key", "k1")
+	logger.Error("renew failed", "key", "k1", "error", errors.New("boom"))
+	is.Contains(buf.String(), "level=DEBUG msg=renew key=k1")
+	is.Contains(buf.String(), "level=ERROR msg=\"renew failed\" key=k1 error=boom")
+}
+
+// 测试空日志
+func TestOrNop(t *testing.T) {
+	is := assert.New(t)
+	is.Equal(Nop(), OrNop(nil))
+	logger := NewSlogLogger(nil)
+	is.Equal(logger, OrNop(logger))
+}
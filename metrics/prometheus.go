@@ -0,0 +1,115 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 14:40:11
+  @desc: Prometheus指标采集适配器
+
+**/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusRecorder 基于Prometheus的指标采集器
+// 同时实现了 prometheus.Collector 接口,可直接注册到Prometheus
+type PrometheusRecorder struct {
+	// 缓存操作次数
+	cacheOps *prometheus.CounterVec
+	// 缓存操作耗时
+	cacheLatency *prometheus.HistogramVec
+	// 加锁次数
+	lockAcquires *prometheus.CounterVec
+	// 加锁耗时
+	lockLatency *prometheus.HistogramVec
+	// 每次加锁的尝试次数
+	lockAttempts prometheus.Histogram
+	// 续约次数
+	lockRenewals *prometheus.CounterVec
+}
+
+// NewPrometheusRecorder 创建Prometheus指标采集器,namespace为指标名称前缀
+func NewPrometheusRecorder(namespace string) *PrometheusRecorder {
+	return &PrometheusRecorder{
+		cacheOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "operations_total",
+			Help:      "Total number of cache operations by operation and result.",
+		}, []string{"op", "result"}),
+		cacheLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of cache operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		lockAcquires: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "lock",
+			Name:      "acquires_total",
+			Help:      "Total number of lock acquisitions by result.",
+		}, []string{"result"}),
+		lockLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "lock",
+			Name:      "acquire_duration_seconds",
+			Help:      "Time spent acquiring locks, including blocking wait.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+		lockAttempts: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "lock",
+			Name:      "acquire_attempts",
+			Help:      "Number of attempts per lock acquisition.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 10),
+		}),
+		lockRenewals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "lock",
+			Name:      "renewals_total",
+			Help:      "Total number of watchdog renewals by result.",
+		}, []string{"result"}),
+	}
+}
+
+// ObserveCache 记录一次缓存操作
+func (r *PrometheusRecorder) ObserveCache(op, result string, duration time.Duration) {
+	r.cacheOps.WithLabelValues(op, result).Inc()
+	r.cacheLatency.WithLabelValues(op).Observe(duration.Seconds())
+}
+
+// ObserveLockAcquire 记录一次加锁
+func (r *PrometheusRecorder) ObserveLockAcquire(result string, attempts int, duration time.Duration) {
+	r.lockAcquires.WithLabelValues(result).Inc()
+	r.lockLatency.WithLabelValues(result).Observe(duration.Seconds())
+	r.lockAttempts.Observe(float64(attempts))
+}
+
+// ObserveLockRenewal 记录一次看门狗续约
+func (r *PrometheusRecorder) ObserveLockRenewal(result string) {
+	r.lockRenewals.WithLabelValues(result).Inc()
+}
+
+// Describe 实现 prometheus.Collector
+func (r *PrometheusRecorder) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range r.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect 实现 prometheus.Collector
+func (r *PrometheusRecorder) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range r.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (r *PrometheusRecorder) collectors() []prometheus.Collector {
+	return []prometheus.Collector{r.cacheOps, r.cacheLatency, r.lockAcquires, r.lockLatency, r.lockAttempts, r.lockRenewals}
+}
+
+// 确保实现了 prometheus.Collector
+var _ prometheus.Collector = (*PrometheusRecorder)(nil)
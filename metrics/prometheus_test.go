@@ -0,0 +1,39 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 15:10:47
+  @desc: Prometheus指标采集单元测试
+
+**/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试Prometheus采集器的计数
+func TestPrometheusRecorder(t *testing.T) {
+	is := assert.New(t)
+	recorder := NewPrometheusRecorder("sugar")
+	registry := prometheus.NewPedanticRegistry()
+	is.NoError(registry.Register(recorder))
+
+	recorder.ObserveCache("Get", CacheHit, time.Millisecond)
+	recorder.ObserveCache("Get", CacheHit, time.Millisecond)
+	recorder.ObserveCache("Get", CacheMiss, time.Millisecond)
+	recorder.ObserveLockAcquire(LockTimeout, 3, time.Second)
+	recorder.ObserveLockRenewal(RenewError)
+
+	is.Equal(2.0, testutil.ToFloat64(recorder.cacheOps.WithLabelValues("Get", CacheHit)))
+	is.Equal(1.0, testutil.ToFloat64(recorder.cacheOps.WithLabelValues("Get", CacheMiss)))
+	is.Equal(1.0, testutil.ToFloat64(recorder.lockAcquires.WithLabelValues(LockTimeout)))
+	is.Equal(1.0, testutil.ToFloat64(recorder.lockRenewals.WithLabelValues(RenewError)))
+	count, err := testutil.GatherAndCount(registry, "sugar_lock_acquire_attempts")
+	is.NoError(err)
+	is.Equal(1, count)
+}
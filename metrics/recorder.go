@@ -0,0 +1,78 @@
+/**
+  @author: Zero
+  @date: 2023/6/15 14:02:36
+  @desc: 缓存与锁的指标采集接口
+
+**/
+
+package metrics
+
+import "time"
+
+// 缓存操作结果
+const (
+	// CacheHit 命中缓存
+	CacheHit = "hit"
+	// CacheMiss 缓存不存在
+	CacheMiss = "miss"
+	// CacheAbsent 命中墓碑,数据确定不存在
+	CacheAbsent = "absent"
+	// CacheError 操作发生错误
+	CacheError = "error"
+	// CacheOk 操作成功,用于无命中语义的操作,例如Set、Del
+	CacheOk = "ok"
+)
+
+// 加锁结果
+const (
+	// LockAcquired 加锁成功
+	LockAcquired = "acquired"
+	// LockFailed 加锁失败,锁已被他人持有或者发生错误
+	LockFailed = "failed"
+	// LockTimeout 阻塞模式等待超时
+	LockTimeout = "timeout"
+	// LockRetryExhausted 阻塞模式重试次数用尽
+	LockRetryExhausted = "retry_exhausted"
+	// LockCanceled 上下文被取消
+	LockCanceled = "canceled"
+)
+
+// 续约结果
+const (
+	// RenewOk 续约成功
+	RenewOk = "ok"
+	// RenewError 续约失败
+	RenewError = "error"
+)
+
+// Recorder 指标采集接口,可以对接Prometheus或者其他指标系统
+type Recorder interface {
+	// ObserveCache 记录一次缓存操作
+	// op: 操作名称,例如Get、Set; result: 操作结果,参考 CacheHit 等常量
+	ObserveCache(op, result string, duration time.Duration)
+	// ObserveLockAcquire 记录一次加锁
+	// result: 加锁结果,参考 LockAcquired 等常量; attempts: 尝试加锁的次数
+	ObserveLockAcquire(result string, attempts int, duration time.Duration)
+	// ObserveLockRenewal 记录一次看门狗续约,result 参考 RenewOk 等常量
+	ObserveLockRenewal(result string)
+}
+
+// 不采集任何指标的实现
+type nopRecorder struct{}
+
+func (nopRecorder) ObserveCache(string, string, time.Duration)   {}
+func (nopRecorder) ObserveLockAcquire(string, int, time.Duration) {}
+func (nopRecorder) ObserveLockRenewal(string)                    {}
+
+// Nop 返回一个不采集任何指标的实现,作为组件的默认指标采集器
+func Nop() Recorder {
+	return nopRecorder{}
+}
+
+// OrNop 如果recorder为nil,则返回 Nop()
+func OrNop(recorder Recorder) Recorder {
+	if recorder == nil {
+		return Nop()
+	}
+	return recorder
+}
@@ -0,0 +1,182 @@
+/**
+  @author: Zero
+  @date: 2023/7/21 09:40:18
+  @desc: 限流器抽象
+
+**/
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zlx2019/sugar/clock"
+	"time"
+)
+
+var (
+	// InvalidLimitErr 限流规则不合法
+	InvalidLimitErr = errors.New("ratelimit: invalid limit")
+	// InvalidCountErr 单次请求的数量不合法
+	InvalidCountErr = errors.New("ratelimit: request count must be positive")
+	// ExceedsLimitErr 单次请求的数量超过了限流器的容量,永远不会被允许
+	ExceedsLimitErr = errors.New("ratelimit: request count exceeds limit capacity")
+)
+
+// Algorithm 限流算法
+type Algorithm int
+
+const (
+	// TokenBucket 令牌桶,桶容量为 Limit.Burst,每个周期匀速补充 Limit.Rate 个令牌
+	TokenBucket Algorithm = iota
+	// SlidingLog 滑动窗口日志,记录每次请求的时间,任意一个周期内最多 Limit.Rate 次请求,精确但占用空间与请求数成正比
+	SlidingLog
+	// SlidingWindow 滑动窗口计数,按上一个固定窗口的计数加权估算,空间固定
+	SlidingWindow
+	// GCRA 通用信元速率算法,请求之间的理想间隔为 Limit.Period / Limit.Rate,允许 Limit.Burst 个突发请求
+	GCRA
+)
+
+// String 算法名称,同时作为存储Key的一部分
+func (algorithm Algorithm) String() string {
+	switch algorithm {
+	case TokenBucket:
+		return "token_bucket"
+	case SlidingLog:
+		return "sliding_log"
+	case SlidingWindow:
+		return "sliding_window"
+	case GCRA:
+		return "gcra"
+	default:
+		return "unknown"
+	}
+}
+
+// 校验算法是否受支持
+func (algorithm Algorithm) check() error {
+	if algorithm < TokenBucket || algorithm > GCRA {
+		return fmt.Errorf("ratelimit: unknown algorithm %d", algorithm)
+	}
+	return nil
+}
+
+// Limit 限流规则: 每个 Period 内允许 Rate 次请求
+// Period / Rate 不能小于1微秒,例如 PerSecond 最多允许每秒1000000次请求
+type Limit struct {
+	// 每个周期允许的请求数
+	Rate int64
+	// 周期
+	Period time.Duration
+	// 突发容量,仅用于 TokenBucket 与 GCRA,为0时等于 Rate
+	Burst int64
+}
+
+// PerSecond 每秒允许rate次请求
+func PerSecond(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute 每分钟允许rate次请求
+func PerMinute(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// PerHour 每小时允许rate次请求
+func PerHour(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Hour}
+}
+
+// 校验限流规则并填补默认值
+// 时间以微秒为单位计算,请求之间的理想间隔不能小于1微秒
+func (limit Limit) normalize() (Limit, error) {
+	if limit.Rate <= 0 || limit.Period <= 0 || limit.Burst < 0 {
+		return limit, InvalidLimitErr
+	}
+	if limit.Period/time.Duration(limit.Rate) < time.Microsecond {
+		return limit, fmt.Errorf("%w: interval %v/%d is less than 1µs", InvalidLimitErr, limit.Period, limit.Rate)
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.Rate
+	}
+	return limit, nil
+}
+
+// 算法的容量,单次请求的数量不能超过该值
+func (limit Limit) capacity(algorithm Algorithm) int64 {
+	if algorithm == TokenBucket || algorithm == GCRA {
+		return limit.Burst
+	}
+	return limit.Rate
+}
+
+// 产生一个令牌(或者一个请求)的理想间隔
+func (limit Limit) interval() time.Duration {
+	return limit.Period / time.Duration(limit.Rate)
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	// 是否允许本次请求
+	Allowed bool
+	// 剩余可用的请求数
+	Remaining int64
+	// 被拒绝时,至少需要等待多久才可能被允许;允许时为0
+	RetryAfter time.Duration
+}
+
+// Limiter 限流器,同一个Key共享一个限流规则
+type Limiter interface {
+	// Allow 判断一次请求是否被允许
+	Allow(ctx context.Context, key string) (Result, error)
+	// AllowN 判断n次请求是否被允许,要么全部允许要么全部拒绝
+	AllowN(ctx context.Context, key string, n int64) (Result, error)
+	// Reset 清除一个Key的限流状态
+	Reset(ctx context.Context, key string) error
+}
+
+// Option 限流器选项
+type Option func(options *options)
+
+type options struct {
+	// 存储Key的前缀
+	prefix string
+	// 时钟
+	clock clock.Clock
+}
+
+// WithPrefix 设置存储Key的前缀,默认为`ratelimit:`
+func WithPrefix(prefix string) Option {
+	return func(options *options) {
+		options.prefix = prefix
+	}
+}
+
+// WithClock 设置限流器使用的时钟,测试时可以注入 clock.Fake
+// Redis限流器使用客户端的时间计算,多个实例之间需要保证时钟同步
+func WithClock(c clock.Clock) Option {
+	return func(options *options) {
+		options.clock = c
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{prefix: "ratelimit:"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.clock = clock.OrReal(o.clock)
+	return o
+}
+
+// 校验单次请求的数量
+func checkCount(limit Limit, algorithm Algorithm, n int64) error {
+	if n <= 0 {
+		return InvalidCountErr
+	}
+	if n > limit.capacity(algorithm) {
+		return ExceedsLimitErr
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+/**
+  @author: Zero
+  @date: 2023/7/21 16:40:12
+  @desc: 限流器单元测试
+
+**/
+
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zlx2019/sugar/clock"
+	"github.com/zlx2019/sugar/internal/redisfake"
+	"github.com/zlx2019/sugar/ratelimit"
+)
+
+var algorithms = []ratelimit.Algorithm{ratelimit.TokenBucket, ratelimit.SlidingLog, ratelimit.SlidingWindow, ratelimit.GCRA}
+
+// 创建限流器,每个后端与算法使用同一个手动时钟
+type factory func(t *testing.T, algorithm ratelimit.Algorithm, limit ratelimit.Limit, fake *clock.Fake) ratelimit.Limiter
+
+var backends = map[string]factory{
+	"Memory": func(t *testing.T, algorithm ratelimit.Algorithm, limit ratelimit.Limit, fake *clock.Fake) ratelimit.Limiter {
+		limiter, err := ratelimit.NewMemoryLimiter(algorithm, limit, ratelimit.WithClock(fake))
+		assert.NoError(t, err)
+		return limiter
+	},
+	"Redis": func(t *testing.T, algorithm ratelimit.Algorithm, limit ratelimit.Limit, fake *clock.Fake) ratelimit.Limiter {
+		limiter, err := ratelimit.NewRedisLimiter(redisfake.New(t), algorithm, limit, ratelimit.WithClock(fake))
+		assert.NoError(t, err)
+		return limiter
+	},
+}
+
+// 对每个后端与算法运行测试,时钟从窗口的起点开始
+func run(t *testing.T, test func(t *testing.T, limiter ratelimit.Limiter, fake *clock.Fake)) {
+	for name, newLimiter := range backends {
+		for _, algorithm := range algorithms {
+			name, newLimiter, algorithm := name, newLimiter, algorithm
+			t.Run(name+"/"+algorithm.String(), func(t *testing.T) {
+				fake := clock.NewFake(time.Unix(1689900000, 0))
+				test(t, newLimiter(t, algorithm, ratelimit.PerSecond(5), fake), fake)
+			})
+		}
+	}
+}
+
+// 测试突发请求、拒绝后的等待时长以及等待后恢复
+func TestLimiter_Allow(t *testing.T) {
+	run(t, func(t *testing.T, limiter ratelimit.Limiter, fake *clock.Fake) {
+		is := assert.New(t)
+		ctx := context.Background()
+		for i := int64(4); i >= 0; i-- {
+			result, err := limiter.Allow(ctx, "user:1")
+			is.NoError(err)
+			is.True(result.Allowed)
+			is.Equal(i, result.Remaining)
+			is.Zero(result.RetryAfter)
+		}
+		result, err := limiter.Allow(ctx, "user:1")
+		is.NoError(err)
+		is.False(result.Allowed)
+		is.Zero(result.Remaining)
+		is.Greater(result.RetryAfter, time.Duration(0))
+
+		// 其他Key不受影响
+		other, err := limiter.Allow(ctx, "user:2")
+		is.NoError(err)
+		is.True(other.Allowed)
+
+		// 等待不足时仍然被拒绝,等待足够后允许
+		fake.Advance(result.RetryAfter - time.Millisecond)
+		denied, err := limiter.Allow(ctx, "user:1")
+		is.NoError(err)
+		is.False(denied.Allowed)
+		fake.Advance(time.Millisecond)
+		allowed, err := limiter.Allow(ctx, "user:1")
+		is.NoError(err)
+		is.True(allowed.Allowed)
+	})
+}
+
+// 测试批量请求要么全部允许要么全部拒绝
+func TestLimiter_AllowN(t *testing.T) {
+	run(t, func(t *testing.T, limiter ratelimit.Limiter, fake *clock.Fake) {
+		is := assert.New(t)
+		ctx := context.Background()
+		_, err := limiter.AllowN(ctx, "batch", 0)
+		is.ErrorIs(err, ratelimit.InvalidCountErr)
+		_, err = limiter.AllowN(ctx, "batch", 6)
+		is.ErrorIs(err, ratelimit.ExceedsLimitErr)
+
+		result, err := limiter.AllowN(ctx, "batch", 3)
+		is.NoError(err)
+		is.True(result.Allowed)
+		is.Equal(int64(2), result.Remaining)
+		result, err = limiter.AllowN(ctx, "batch", 3)
+		is.NoError(err)
+		is.False(result.Allowed)
+		is.Equal(int64(2), result.Remaining)
+		result, err = limiter.AllowN(ctx, "batch", 2)
+		is.NoError(err)
+		is.True(result.Allowed)
+		is.Zero(result.Remaining)
+
+		// 等待两个周期后恢复全部容量
+		fake.Advance(time.Second * 2)
+		result, err = limiter.AllowN(ctx, "batch", 5)
+		is.NoError(err)
+		is.True(result.Allowed)
+	})
+}
+
+// 测试清除限流状态
+func TestLimiter_Reset(t *testing.T) {
+	run(t, func(t *testing.T, limiter ratelimit.Limiter, fake *clock.Fake) {
+		is := assert.New(t)
+		ctx := context.Background()
+		result, err := limiter.AllowN(ctx, "reset", 5)
+		is.NoError(err)
+		is.True(result.Allowed)
+		result, _ = limiter.Allow(ctx, "reset")
+		is.False(result.Allowed)
+
+		is.NoError(limiter.Reset(ctx, "reset"))
+		result, err = limiter.Allow(ctx, "reset")
+		is.NoError(err)
+		is.True(result.Allowed)
+		is.Equal(int64(4), result.Remaining)
+	})
+}
+
+// 测试突发容量
+func TestLimiter_Burst(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+	for _, algorithm := range []ratelimit.Algorithm{ratelimit.TokenBucket, ratelimit.GCRA} {
+		fake := clock.NewFake(time.Unix(1689900000, 0))
+		limiter, err := ratelimit.NewMemoryLimiter(algorithm, ratelimit.Limit{Rate: 1, Period: time.Second, Burst: 3}, ratelimit.WithClock(fake))
+		is.NoError(err)
+		result, err := limiter.AllowN(ctx, "burst", 3)
+		is.NoError(err)
+		is.True(result.Allowed, algorithm.String())
+		result, _ = limiter.Allow(ctx, "burst")
+		is.False(result.Allowed, algorithm.String())
+		is.Equal(time.Second, result.RetryAfter, algorithm.String())
+	}
+}
+
+// 测试不合法的限流规则
+func TestNewLimiter_Invalid(t *testing.T) {
+	is := assert.New(t)
+	_, err := ratelimit.NewMemoryLimiter(ratelimit.TokenBucket, ratelimit.Limit{Rate: 0, Period: time.Second})
+	is.ErrorIs(err, ratelimit.InvalidLimitErr)
+	_, err = ratelimit.NewMemoryLimiter(ratelimit.TokenBucket, ratelimit.Limit{Rate: 1, Period: time.Second, Burst: -1})
+	is.ErrorIs(err, ratelimit.InvalidLimitErr)
+	_, err = ratelimit.NewMemoryLimiter(ratelimit.Algorithm(9), ratelimit.PerSecond(1))
+	is.Error(err)
+
+	// 请求之间的理想间隔小于1微秒
+	_, err = ratelimit.NewMemoryLimiter(ratelimit.TokenBucket, ratelimit.Limit{Rate: 1, Period: time.Nanosecond * 500})
+	is.ErrorIs(err, ratelimit.InvalidLimitErr)
+	_, err = ratelimit.NewRedisLimiter(redisfake.New(t), ratelimit.GCRA, ratelimit.PerSecond(2_000_000))
+	is.ErrorIs(err, ratelimit.InvalidLimitErr)
+	_, err = ratelimit.NewMemoryLimiter(ratelimit.SlidingWindow, ratelimit.PerSecond(1_000_000))
+	is.NoError(err)
+}
+
+// 测试时钟回拨(例如多个实例之间的时钟偏差)后不会凭空补充容量
+func TestLimiter_ClockSkew(t *testing.T) {
+	for name, newLimiter := range backends {
+		for _, algorithm := range []ratelimit.Algorithm{ratelimit.TokenBucket, ratelimit.GCRA} {
+			name, newLimiter, algorithm := name, newLimiter, algorithm
+			t.Run(name+"/"+algorithm.String(), func(t *testing.T) {
+				is := assert.New(t)
+				ctx := context.Background()
+				epoch := time.Unix(1689900000, 0)
+				fake := clock.NewFake(epoch.Add(time.Second))
+				limiter := newLimiter(t, algorithm, ratelimit.PerSecond(5), fake)
+				result, err := limiter.AllowN(ctx, "skew", 5)
+				is.NoError(err)
+				is.True(result.Allowed)
+
+				// 一个时钟落后500毫秒的请求
+				fake.Set(epoch.Add(time.Millisecond * 500))
+				result, err = limiter.Allow(ctx, "skew")
+				is.NoError(err)
+				is.False(result.Allowed)
+
+				// 时钟恢复后没有经过任何时间,仍然被拒绝
+				fake.Set(epoch.Add(time.Second))
+				result, err = limiter.Allow(ctx, "skew")
+				is.NoError(err)
+				is.False(result.Allowed)
+				is.Zero(result.Remaining)
+			})
+		}
+	}
+}
@@ -0,0 +1,231 @@
+/**
+  @author: Zero
+  @date: 2023/7/21 14:28:05
+  @desc: 基于进程内存的限流器
+
+**/
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// 每处理多少次请求清理一次过期的限流状态
+const sweepEvery = 1024
+
+// MemoryLimiter 进程内的限流器,算法与 RedisLimiter 完全一致,适用于单实例部署以及单元测试
+type MemoryLimiter struct {
+	options
+	// 限流算法
+	algorithm Algorithm
+	// 限流规则
+	limit Limit
+	mu    sync.Mutex
+	// 每个Key的限流状态
+	states map[string]*memoryState
+	// 距离上次清理处理的请求数
+	calls int
+}
+
+// 一个Key的限流状态,时间均为微秒
+type memoryState struct {
+	// 令牌桶: 剩余令牌数以及上次补充的时间
+	tokens float64
+	ts     int64
+	// 滑动窗口日志: 窗口内每次请求的时间
+	log []int64
+	// 滑动窗口计数: 当前窗口的序号以及当前、上一个窗口的计数
+	index    int64
+	current  int64
+	previous int64
+	// GCRA: 理论到达时间
+	tat float64
+	// 状态的过期时间
+	expireAt int64
+}
+
+// NewMemoryLimiter 创建一个进程内的限流器
+func NewMemoryLimiter(algorithm Algorithm, limit Limit, opts ...Option) (*MemoryLimiter, error) {
+	if err := algorithm.check(); err != nil {
+		return nil, err
+	}
+	limit, err := limit.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryLimiter{
+		options:   newOptions(opts),
+		algorithm: algorithm,
+		limit:     limit,
+		states:    make(map[string]*memoryState),
+	}, nil
+}
+
+// Allow 判断一次请求是否被允许
+func (limiter *MemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return limiter.AllowN(ctx, key, 1)
+}
+
+// AllowN 判断n次请求是否被允许
+func (limiter *MemoryLimiter) AllowN(_ context.Context, key string, n int64) (Result, error) {
+	if err := checkCount(limiter.limit, limiter.algorithm, n); err != nil {
+		return Result{}, err
+	}
+	now := limiter.clock.Now().UnixMicro()
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.sweep(now)
+	state, ok := limiter.states[key]
+	if !ok || now >= state.expireAt {
+		state = &memoryState{}
+		limiter.states[key] = state
+	}
+	var allowed bool
+	var remaining, retry int64
+	switch limiter.algorithm {
+	case TokenBucket:
+		allowed, remaining, retry = limiter.tokenBucket(state, now, n)
+	case SlidingLog:
+		allowed, remaining, retry = limiter.slidingLog(state, now, n)
+	case SlidingWindow:
+		allowed, remaining, retry = limiter.slidingWindow(state, now, n)
+	case GCRA:
+		allowed, remaining, retry = limiter.gcra(state, now, n)
+	}
+	return Result{
+		Allowed:    allowed,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retry) * time.Microsecond,
+	}, nil
+}
+
+// 清理过期的限流状态,调用方需持有 mu
+func (limiter *MemoryLimiter) sweep(now int64) {
+	if limiter.calls++; limiter.calls < sweepEvery {
+		return
+	}
+	limiter.calls = 0
+	for key, state := range limiter.states {
+		if now >= state.expireAt {
+			delete(limiter.states, key)
+		}
+	}
+}
+
+// 令牌桶,与 TokenBucketScript 一致
+func (limiter *MemoryLimiter) tokenBucket(state *memoryState, now, n int64) (bool, int64, int64) {
+	capacity := float64(limiter.limit.Burst)
+	interval := float64(limiter.limit.Period.Microseconds() / limiter.limit.Rate)
+	if state.expireAt == 0 {
+		state.tokens = capacity
+		state.ts = now
+	}
+	// 时钟回拨时保留较晚的补充时间,避免重复补充令牌
+	if now > state.ts {
+		state.tokens = math.Min(capacity, state.tokens+float64(now-state.ts)/interval)
+		state.ts = now
+	}
+	state.expireAt = now + ttlMillis(limiter.limit.interval()*time.Duration(limiter.limit.Burst))*1000
+	if state.tokens >= float64(n) {
+		state.tokens -= float64(n)
+		return true, int64(math.Floor(state.tokens)), 0
+	}
+	return false, int64(math.Floor(state.tokens)), int64(math.Ceil((float64(n) - state.tokens) * interval))
+}
+
+// 滑动窗口日志,与 SlidingLogScript 一致
+func (limiter *MemoryLimiter) slidingLog(state *memoryState, now, n int64) (bool, int64, int64) {
+	limit := limiter.limit.Rate
+	window := limiter.limit.Period.Microseconds()
+	// 移出窗口之外的请求
+	i := 0
+	for i < len(state.log) && state.log[i] <= now-window {
+		i++
+	}
+	state.log = state.log[i:]
+	count := int64(len(state.log))
+	if count+n <= limit {
+		for j := int64(0); j < n; j++ {
+			state.log = append(state.log, now)
+		}
+		state.expireAt = now + ttlMillis(limiter.limit.Period)*1000
+		return true, limit - count - n, 0
+	}
+	var retry int64
+	if index := count + n - limit - 1; index < count {
+		retry = state.log[index] + window - now
+	}
+	if state.expireAt == 0 {
+		state.expireAt = now
+	}
+	return false, max(0, limit-count), retry
+}
+
+// 滑动窗口计数,与 SlidingWindowScript 一致
+func (limiter *MemoryLimiter) slidingWindow(state *memoryState, now, n int64) (bool, int64, int64) {
+	limit := float64(limiter.limit.Rate)
+	window := limiter.limit.Period.Microseconds()
+	index := now / window
+	elapsed := float64(now % window)
+	// 窗口前进时滚动计数
+	switch {
+	case index == state.index+1:
+		state.previous, state.current = state.current, 0
+	case index != state.index:
+		state.previous, state.current = 0, 0
+	}
+	state.index = index
+	current, previous := float64(state.current), float64(state.previous)
+	estimated := previous*(float64(window)-elapsed)/float64(window) + current
+	if estimated+float64(n) <= limit {
+		state.current += n
+		state.expireAt = now + ttlMillis(limiter.limit.Period*2)*1000
+		return true, int64(math.Floor(limit - estimated - float64(n))), 0
+	}
+	var retry float64
+	if previous > 0 && current+float64(n) <= limit {
+		// 等待上一个窗口的权重降低
+		retry = float64(window) - elapsed - (limit-current-float64(n))*float64(window)/previous
+	} else {
+		// 等待进入下一个窗口,并且当前窗口的权重降低
+		retry = 2*float64(window) - elapsed - (limit-float64(n))*float64(window)/current
+	}
+	if state.expireAt == 0 {
+		state.expireAt = now + ttlMillis(limiter.limit.Period*2)*1000
+	}
+	return false, int64(max(0, math.Floor(limit-estimated))), int64(math.Ceil(retry))
+}
+
+// GCRA,与 GCRAScript 一致
+func (limiter *MemoryLimiter) gcra(state *memoryState, now, n int64) (bool, int64, int64) {
+	interval := float64(limiter.limit.Period.Microseconds() / limiter.limit.Rate)
+	tolerance := interval * float64(limiter.limit.Burst)
+	tat := state.tat
+	if tat < float64(now) {
+		tat = float64(now)
+	}
+	newTat := tat + interval*float64(n)
+	diff := float64(now) - (newTat - tolerance)
+	if diff < 0 {
+		if state.expireAt == 0 {
+			state.expireAt = now
+		}
+		remaining := max(0, math.Floor((float64(now)-(tat-tolerance))/interval))
+		return false, int64(remaining), int64(math.Ceil(-diff))
+	}
+	state.tat = newTat
+	state.expireAt = now + ttlMillis(time.Duration(newTat-float64(now))*time.Microsecond)*1000
+	return true, int64(math.Floor(diff / interval)), 0
+}
+
+// Reset 清除一个Key的限流状态
+func (limiter *MemoryLimiter) Reset(_ context.Context, key string) error {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	delete(limiter.states, key)
+	return nil
+}
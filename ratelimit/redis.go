@@ -0,0 +1,123 @@
+/**
+  @author: Zero
+  @date: 2023/7/21 11:02:44
+  @desc: 基于Redis的分布式限流器
+
+**/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/zlx2019/sugar/caches"
+	"github.com/zlx2019/toys/randoms"
+	"strconv"
+	"time"
+)
+
+// RedisLimiter 基于Redis的分布式限流器,每种算法都通过一个Lua脚本原子性地完成判断与扣减
+type RedisLimiter struct {
+	options
+	// Redis客户端
+	template caches.RedisTemplate
+	// 限流算法
+	algorithm Algorithm
+	// 限流规则
+	limit Limit
+}
+
+// NewRedisLimiter 创建一个Redis限流器
+func NewRedisLimiter(template caches.RedisTemplate, algorithm Algorithm, limit Limit, opts ...Option) (*RedisLimiter, error) {
+	if err := algorithm.check(); err != nil {
+		return nil, err
+	}
+	limit, err := limit.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisLimiter{
+		options:   newOptions(opts),
+		template:  template,
+		algorithm: algorithm,
+		limit:     limit,
+	}, nil
+}
+
+// 存储Key
+func (limiter *RedisLimiter) key(key string) string {
+	return limiter.prefix + limiter.algorithm.String() + ":" + key
+}
+
+// 滑动窗口计数的当前窗口与上一个窗口的Key,以及当前时间在当前窗口中已经过的时长
+func (limiter *RedisLimiter) windowKeys(key string, now time.Time) (current, previous string, elapsed time.Duration) {
+	window := limiter.limit.Period.Microseconds()
+	micros := now.UnixMicro()
+	index := micros / window
+	base := limiter.key(key) + ":"
+	return base + strconv.FormatInt(index, 10), base + strconv.FormatInt(index-1, 10), time.Duration(micros%window) * time.Microsecond
+}
+
+// 有效期的毫秒数,至少为1毫秒
+func ttlMillis(d time.Duration) int64 {
+	ms := (d + time.Millisecond - 1).Milliseconds()
+	if ms < 1 {
+		return 1
+	}
+	return ms
+}
+
+// Allow 判断一次请求是否被允许
+func (limiter *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return limiter.AllowN(ctx, key, 1)
+}
+
+// AllowN 判断n次请求是否被允许
+func (limiter *RedisLimiter) AllowN(ctx context.Context, key string, n int64) (Result, error) {
+	if err := checkCount(limiter.limit, limiter.algorithm, n); err != nil {
+		return Result{}, err
+	}
+	limit := limiter.limit
+	now := limiter.clock.Now()
+	interval := limit.Period.Microseconds() / limit.Rate
+	var values []int64
+	var err error
+	switch limiter.algorithm {
+	case TokenBucket:
+		values, err = limiter.template.EvalScript(ctx, tokenBucketScript, []string{limiter.key(key)},
+			limit.Burst, interval, now.UnixMicro(), n, ttlMillis(limit.interval()*time.Duration(limit.Burst))).Int64Slice()
+	case SlidingLog:
+		values, err = limiter.template.EvalScript(ctx, slidingLogScript, []string{limiter.key(key)},
+			limit.Rate, limit.Period.Microseconds(), now.UnixMicro(), n, randoms.RandomString(12), ttlMillis(limit.Period)).Int64Slice()
+	case SlidingWindow:
+		current, previous, elapsed := limiter.windowKeys(key, now)
+		values, err = limiter.template.EvalScript(ctx, slidingWindowScript, []string{current, previous},
+			limit.Rate, limit.Period.Microseconds(), elapsed.Microseconds(), n, ttlMillis(limit.Period*2)).Int64Slice()
+	case GCRA:
+		values, err = limiter.template.EvalScript(ctx, gcraScript, []string{limiter.key(key)},
+			interval, limit.Burst, now.UnixMicro(), n).Int64Slice()
+	default:
+		return Result{}, fmt.Errorf("ratelimit: unknown algorithm %d", limiter.algorithm)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected script result %v", values)
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
+
+// Reset 清除一个Key的限流状态
+func (limiter *RedisLimiter) Reset(ctx context.Context, key string) error {
+	keys := []string{limiter.key(key)}
+	if limiter.algorithm == SlidingWindow {
+		current, previous, _ := limiter.windowKeys(key, limiter.clock.Now())
+		keys = []string{current, previous}
+	}
+	return limiter.template.WithContext(ctx).Del(keys...)
+}
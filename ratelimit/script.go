@@ -0,0 +1,130 @@
+/**
+  @author: Zero
+  @date: 2023/7/21 10:15:37
+  @desc: 限流算法的Lua脚本
+
+**/
+
+package ratelimit
+
+import "github.com/zlx2019/sugar/caches"
+
+// 所有脚本返回 {是否允许(1/0), 剩余请求数, 重试等待的微秒数}
+// 时间统一以微秒为单位,由客户端传入
+
+// TokenBucketScript 令牌桶
+// KEYS[1]: 桶状态(Hash: tokens, ts)
+// ARGV[1]: 桶容量, ARGV[2]: 产生一个令牌的微秒数, ARGV[3]: 当前时间, ARGV[4]: 请求数, ARGV[5]: 状态有效期毫秒数
+const TokenBucketScript = `
+	local capacity = tonumber(ARGV[1])
+	local interval = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	local tokens = tonumber(state[1])
+	local ts = tonumber(state[2])
+	if tokens == nil or ts == nil then
+		tokens = capacity
+		ts = now
+	end
+	if now > ts then
+		tokens = math.min(capacity, tokens + (now - ts) / interval)
+		ts = now
+	end
+	local allowed = 0
+	local retry = 0
+	if tokens >= n then
+		tokens = tokens - n
+		allowed = 1
+	else
+		retry = math.ceil((n - tokens) * interval)
+	end
+	-- 时钟回拨(例如多个实例之间的时钟偏差)时保留较晚的补充时间,避免重复补充令牌
+	redis.call('HSET', KEYS[1], 'tokens', string.format('%.6f', tokens), 'ts', string.format('%.0f', ts))
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+	return {allowed, math.floor(tokens), retry}
+`
+
+// SlidingLogScript 滑动窗口日志
+// KEYS[1]: 请求日志(ZSet: 成员为请求标识, 分数为请求时间)
+// ARGV[1]: 窗口内允许的请求数, ARGV[2]: 窗口微秒数, ARGV[3]: 当前时间, ARGV[4]: 请求数, ARGV[5]: 本次请求的唯一标识, ARGV[6]: 日志有效期毫秒数
+const SlidingLogScript = `
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', string.format('%.0f', now - window))
+	local count = redis.call('ZCARD', KEYS[1])
+	if count + n <= limit then
+		for i = 1, n do
+			redis.call('ZADD', KEYS[1], ARGV[3], ARGV[5] .. ':' .. i)
+		end
+		redis.call('PEXPIRE', KEYS[1], ARGV[6])
+		return {1, limit - count - n, 0}
+	end
+	-- 需要等待最早的若干个请求移出窗口
+	local index = count + n - limit - 1
+	local oldest = redis.call('ZRANGE', KEYS[1], index, index, 'WITHSCORES')
+	local retry = 0
+	if oldest[2] then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, math.max(0, limit - count), retry}
+`
+
+// SlidingWindowScript 滑动窗口计数
+// KEYS[1]: 当前窗口的计数, KEYS[2]: 上一个窗口的计数
+// ARGV[1]: 窗口内允许的请求数, ARGV[2]: 窗口微秒数, ARGV[3]: 当前时间在当前窗口中已经过的微秒数, ARGV[4]: 请求数, ARGV[5]: 计数有效期毫秒数
+const SlidingWindowScript = `
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local elapsed = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+	local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+	local estimated = previous * (window - elapsed) / window + current
+	if estimated + n <= limit then
+		redis.call('INCRBY', KEYS[1], n)
+		redis.call('PEXPIRE', KEYS[1], ARGV[5])
+		return {1, math.floor(limit - estimated - n), 0}
+	end
+	local retry
+	if previous > 0 and current + n <= limit then
+		-- 等待上一个窗口的权重降低
+		retry = window - elapsed - (limit - current - n) * window / previous
+	else
+		-- 等待进入下一个窗口,并且当前窗口的权重降低
+		retry = window - elapsed + window - (limit - n) * window / current
+	end
+	return {0, math.max(0, math.floor(limit - estimated)), math.ceil(retry)}
+`
+
+// GCRAScript 通用信元速率算法
+// KEYS[1]: 理论到达时间(TAT)
+// ARGV[1]: 请求之间的理想间隔微秒数, ARGV[2]: 突发容量, ARGV[3]: 当前时间, ARGV[4]: 请求数
+const GCRAScript = `
+	local interval = tonumber(ARGV[1])
+	local tolerance = interval * tonumber(ARGV[2])
+	local now = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	local tat = tonumber(redis.call('GET', KEYS[1]) or ARGV[3])
+	if tat < now then
+		tat = now
+	end
+	local newTat = tat + interval * n
+	local diff = now - (newTat - tolerance)
+	if diff < 0 then
+		local remaining = math.max(0, math.floor((now - (tat - tolerance)) / interval))
+		return {0, remaining, math.ceil(-diff)}
+	end
+	redis.call('SET', KEYS[1], string.format('%.0f', newTat), 'PX', math.max(1, math.ceil((newTat - now) / 1000)))
+	return {1, math.floor(diff / interval), 0}
+`
+
+// 限流脚本,通过EVALSHA调用
+var (
+	tokenBucketScript   = caches.NewScript("sugar_ratelimit_token_bucket", TokenBucketScript)
+	slidingLogScript    = caches.NewScript("sugar_ratelimit_sliding_log", SlidingLogScript)
+	slidingWindowScript = caches.NewScript("sugar_ratelimit_sliding_window", SlidingWindowScript)
+	gcraScript          = caches.NewScript("sugar_ratelimit_gcra", GCRAScript)
+)